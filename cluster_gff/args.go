@@ -4,6 +4,7 @@ import (
 	"flag"
 	"fmt"
 	"os"
+	"strings"
 )
 
 var Version, Build string
@@ -19,6 +20,18 @@ type CmdArgs struct {
 	MinIsoPercent        float64
 	ClustersOut          string
 	ProfFile             string
+	ErrorPolicy          string
+	RejectsOut           string
+	OutFormat            string
+	RefGenome            string
+	CellCountsOut        string
+	Algorithm            string
+	SampleLabels         string
+	Samples              []string
+	MatrixOut            string
+	PerSample            bool
+	DeterministicIDs     bool
+	GeneGrouping         bool
 }
 
 // Parse command line arguments using the flag package.
@@ -31,6 +44,17 @@ func (a *CmdArgs) Parse() {
 	flag.Int64Var(&a.EndBoundaryTolerance, "e", 30, "Terminal exons boundary tolerance.")
 	flag.Int64Var(&a.MinCoverage, "c", 10, "Minimum cluster size.")
 	flag.Float64Var(&a.MinIsoPercent, "p", 1.0, "Minimum isoform percentage.")
+	flag.StringVar(&a.OutFormat, "F", FormatGFF2, "Output format (gff2, gtf, gff3 or bed12).")
+	flag.StringVar(&a.RefGenome, "G", "", "Indexed reference genome FASTA used for annotating splice site motifs.")
+	flag.StringVar(&a.CellCountsOut, "x", "", "Write per-cell isoform counts (from cell_barcode and umi attributes) in this file.")
+	flag.StringVar(&a.ErrorPolicy, "E", PolicyStrict, "Policy for malformed transcripts (strict, skip or warn).")
+	flag.StringVar(&a.RejectsOut, "X", "", "Write features of skipped malformed transcripts to this file.")
+	flag.BoolVar(&a.DeterministicIDs, "D", false, "Derive cluster and group identifiers from the coordinates instead of random UUIDs.")
+	flag.StringVar(&a.Algorithm, "A", ClusterGreedy, "Clustering algorithm: greedy (first matching cluster in input order) or seeded (order independent).")
+	flag.StringVar(&a.SampleLabels, "l", "", "Comma separated sample labels of the input files (default: file names without extension).")
+	flag.StringVar(&a.MatrixOut, "m", "", "Write transcript by sample count matrix in this file.")
+	flag.BoolVar(&a.GeneGrouping, "g", false, "Group clusters into genes by shared exonic bases on the same strand and calculate isoform percentages per gene.")
+	flag.BoolVar(&a.PerSample, "s", false, "Apply the -c and -p thresholds on per-sample support (passing in at least one sample).")
 	flag.BoolVar(&help, "h", false, "Print out help message.")
 	flag.Int64Var(&a.MaxProcs, "t", 4, "Number of cores to use.")
 	flag.StringVar(&a.ProfFile, "prof", "", "Write out CPU profiling information.")
@@ -52,8 +76,36 @@ func (a *CmdArgs) Parse() {
 	a.InputFiles = flag.Args()
 
 	//Check parameters:
-	if len(a.InputFiles) > 1 {
-		L.Fatalf("The maximum number of input files is one!\n")
+	// Set sample labels:
+	switch {
+	case a.SampleLabels != "":
+		a.Samples = strings.Split(a.SampleLabels, ",")
+	case len(a.InputFiles) > 0:
+		a.Samples = SampleLabels(a.InputFiles)
+	default:
+		a.Samples = []string{"stdin"}
+	}
+	if len(a.InputFiles) > 0 && len(a.Samples) != len(a.InputFiles) {
+		L.Fatalf("The number of sample labels must match the number of input files!\n")
+	}
+	if len(a.InputFiles) == 0 && len(a.Samples) != 1 {
+		L.Fatalf("A single sample label is allowed when reading from standard input!\n")
+	}
+	seenSamples := make(map[string]bool, len(a.Samples))
+	for _, sample := range a.Samples {
+		if seenSamples[sample] {
+			L.Fatalf("Duplicate sample label: %s (set unique labels using -l)\n", sample)
+		}
+		seenSamples[sample] = true
+	}
+	if !ValidAlgorithm(a.Algorithm) {
+		L.Fatalf("Unsupported clustering algorithm: %s\n", a.Algorithm)
+	}
+	if !ValidPolicy(a.ErrorPolicy) {
+		L.Fatalf("Unsupported error policy: %s\n", a.ErrorPolicy)
+	}
+	if !ValidFormat(a.OutFormat) {
+		L.Fatalf("Unsupported output format: %s\n", a.OutFormat)
 	}
 
 }
@@ -0,0 +1,53 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"sort"
+)
+
+// Create per-cell counts tabular output and write header.
+func CreateCellCountsOut(countsOut string) io.Writer {
+	fh, err := os.Create(countsOut)
+	if err != nil {
+		L.Fatalf("Could not create per-cell counts output %s: %s", countsOut, err)
+	}
+	fmt.Fprintf(fh, "Transcript\tGene\tCell\tCount\n")
+	return fh
+}
+
+// Write the number of molecules supporting a cluster in each cell. Reads
+// sharing a UMI within a cell are counted once, reads without a cell barcode
+// are ignored.
+func WriteCellCounts(cluster *TranscriptCluster, countsOut io.Writer) {
+	umis := make(map[string]map[string]bool)
+	counts := make(map[string]int)
+
+	for _, tr := range cluster.Transcripts {
+		cell, umi := tr.Cell, tr.UMI
+		if cell == "" {
+			continue
+		}
+		if umi != "" {
+			if umis[cell] == nil {
+				umis[cell] = make(map[string]bool)
+			}
+			if umis[cell][umi] {
+				continue
+			}
+			umis[cell][umi] = true
+		}
+		counts[cell]++
+	}
+
+	cells := make([]string, 0, len(counts))
+	for cell := range counts {
+		cells = append(cells, cell)
+	}
+	sort.Strings(cells)
+
+	for _, cell := range cells {
+		fmt.Fprintf(countsOut, "%s\t%s\t%s\t%d\n", cluster.ID, cluster.GroupID, cell, counts[cell])
+	}
+}
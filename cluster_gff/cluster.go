@@ -1,30 +1,81 @@
 package main
 
 import (
-	"github.com/biogo/biogo/feat/gene"
+	"fmt"
+	"hash/fnv"
+	"sort"
+	"strings"
+
 	"github.com/google/uuid"
 )
 
+// Clustering algorithms:
+const (
+	ClusterGreedy = "greedy" // Add transcripts to the first matching cluster in input order.
+	ClusterSeeded = "seeded" // Assign distinct structures to the closest cluster seed by decreasing support.
+)
+
+// Check whether the clustering algorithm is supported.
+func ValidAlgorithm(algorithm string) bool {
+	switch algorithm {
+	case ClusterGreedy, ClusterSeeded:
+		return true
+	}
+	return false
+}
+
 // Struct to hold a transcript cluster:
 type TranscriptCluster struct {
-	Transcripts []*gene.CodingTranscript
-	ID          string
-	GroupID     string
-	LocusSize   int
+	Transcripts      []*InputTranscript
+	ID               string
+	GroupID          string
+	LocusSize        int
+	SampleLocusSizes map[string]int // Size of the group in each sample.
 }
 
 func (tc TranscriptCluster) IsoPercent() float64 {
 	return (100.0 * float64(len(tc.Transcripts))) / float64(tc.LocusSize)
 }
 
-// Cluster transcripts from a sorted source.
-func ClusterTranscriptStream(trStream chan *gene.CodingTranscript, BoundaryTolerance int, EndBoundaryTolerance int) chan *TranscriptCluster {
+// Struct to hold a group of soft related transcripts and its clusters:
+type groupJob struct {
+	cache    []*InputTranscript
+	clusters []*TranscriptCluster
+	done     chan struct{} // Closed when the group has been processed.
+}
+
+// Cluster transcripts from a sorted source. Groups of soft related transcripts
+// are processed in parallel, while the clusters are sent out in input order.
+// If requested, the clusters of groups with overlapping spans are grouped
+// into genes before being sent out.
+func ClusterTranscriptStream(trStream chan *InputTranscript, BoundaryTolerance int, EndBoundaryTolerance int, algorithm string, deterministicIDs bool, geneGrouping bool, nrProc int) chan *TranscriptCluster {
+	if nrProc < 1 {
+		nrProc = 1
+	}
+
 	// Output channel:
 	clusterChan := make(chan *TranscriptCluster, 1000)
+	// Channel of groups to process and channel of groups in input order:
+	workChan := make(chan *groupJob, nrProc)
+	orderedChan := make(chan *groupJob, 2*nrProc)
+
+	// Select clustering algorithm:
+	processCache := ProcessCache
+	if algorithm == ClusterSeeded {
+		processCache = ProcessCacheSeeded
+	}
+
+	// Dispatch a group for processing:
+	dispatch := func(cache []*InputTranscript) {
+		job := &groupJob{cache: cache, done: make(chan struct{})}
+		orderedChan <- job
+		workChan <- job
+	}
 
-	// Cache to hold transcript belonging to the same group:
-	cache := make([]*gene.CodingTranscript, 0, 1000)
 	go func() {
+		// Cache to hold transcript belonging to the same group:
+		cache := make([]*InputTranscript, 0, 1000)
+
 		// Pull transcripts:
 		for tr := range trStream {
 
@@ -34,18 +85,79 @@ func ClusterTranscriptStream(trStream chan *gene.CodingTranscript, BoundaryToler
 				cache = append(cache, tr)
 			} else {
 				// We found the next group, copy cache:
-				tmp := make([]*gene.CodingTranscript, len(cache))
+				tmp := make([]*InputTranscript, len(cache))
 				copy(tmp, cache)
 				// Process group to generate clusters:
-				ProcessCache(tmp, BoundaryTolerance, EndBoundaryTolerance, clusterChan)
+				dispatch(tmp)
 				// Add the current transcript to cache as new group:
 				cache = cache[:1]
 				cache[0] = tr
 			}
 		}
 		// Process last group:
-		ProcessCache(cache, BoundaryTolerance, EndBoundaryTolerance, clusterChan)
+		if len(cache) > 0 {
+			dispatch(cache)
+		}
+
+		close(orderedChan)
+		close(workChan)
+	}()
 
+	// Start workers processing the groups:
+	for i := 0; i < nrProc; i++ {
+		go func() {
+			for job := range workChan {
+				job.clusters = processCache(job.cache, BoundaryTolerance, EndBoundaryTolerance, deterministicIDs)
+				// Register the size of the group in each sample:
+				sampleSizes := sampleCounts(job.cache)
+				for _, cls := range job.clusters {
+					cls.SampleLocusSizes = sampleSizes
+				}
+				close(job.done)
+			}
+		}()
+	}
+
+	// Send out clusters in input order:
+	go func() {
+		// Window of clusters which might belong to the same genes:
+		window := make([]*TranscriptCluster, 0, 100)
+		var windowChrom string
+		windowEnd := -1
+
+		// Assign genes and send out the clusters in the window gene by gene:
+		flush := func() {
+			for _, cls := range AssignGenes(window, deterministicIDs) {
+				clusterChan <- cls
+			}
+			window = window[:0]
+			windowEnd = -1
+		}
+
+		for job := range orderedChan {
+			<-job.done
+			if !geneGrouping {
+				for _, cls := range job.clusters {
+					clusterChan <- cls
+				}
+				continue
+			}
+
+			// The groups are sorted by start, so genes cannot span past a group
+			// starting after the end of the window:
+			first := job.cache[0]
+			if len(window) > 0 && (first.Location().Name() != windowChrom || first.Start() >= windowEnd) {
+				flush()
+			}
+			windowChrom = first.Location().Name()
+			for _, tr := range job.cache {
+				windowEnd = MaxInt(windowEnd, tr.End())
+			}
+			window = append(window, job.clusters...)
+		}
+		if len(window) > 0 {
+			flush()
+		}
 		close(clusterChan)
 	}()
 
@@ -53,7 +165,7 @@ func ClusterTranscriptStream(trStream chan *gene.CodingTranscript, BoundaryToler
 }
 
 // Serach for a matching cluster in a slice of clusters:
-func searchClusters(tr *gene.CodingTranscript, clusters []*TranscriptCluster, BoundaryTolerance, EndBoundaryTolerance int) int {
+func searchClusters(tr *InputTranscript, clusters []*TranscriptCluster, BoundaryTolerance, EndBoundaryTolerance int) int {
 	// Empty cluster:
 	if len(clusters) == 0 {
 		return -1
@@ -73,23 +185,54 @@ func searchClusters(tr *gene.CodingTranscript, clusters []*TranscriptCluster, Bo
 	return -1
 }
 
-// Create new cluster having the specified group id and a unique id.
-func NewCluster(groupID string, locusSize int) *TranscriptCluster {
+// Generate a group identifier: a random UUID or the span of the group.
+func GroupIdentifier(cache []*InputTranscript, deterministic bool) string {
+	if !deterministic {
+		return uuid.New().String()
+	}
+	start, end := cache[0].Start(), cache[0].End()
+	for _, tr := range cache[1:] {
+		if tr.Start() < start {
+			start = tr.Start()
+		}
+		if tr.End() > end {
+			end = tr.End()
+		}
+	}
+	return fmt.Sprintf("%s:%d-%d", cache[0].Location().Name(), start+1, end)
+}
+
+// Generate a cluster identifier: a random UUID or the coordinates, strand and
+// intron chain hash of the transcript seeding the cluster.
+func ClusterIdentifier(seed *InputTranscript, deterministic bool) string {
+	if !deterministic {
+		return uuid.New().String()
+	}
+	exons := seed.Exons()
+	h := fnv.New32a()
+	for i := 1; i < len(exons); i++ {
+		fmt.Fprintf(h, "%d-%d;", seed.Offset+exons[i-1].End(), seed.Offset+exons[i].Start())
+	}
+	return fmt.Sprintf("%s:%d-%d:%s:%08x", seed.Location().Name(), seed.Start()+1, seed.End(), strandString(seed.Orient), h.Sum32())
+}
+
+// Create new cluster having the specified group id and cluster id.
+func NewCluster(groupID, id string, locusSize int) *TranscriptCluster {
 	newCls := new(TranscriptCluster)
 	newCls.GroupID = groupID
-	newCls.ID = uuid.New().String()
+	newCls.ID = id
 	newCls.LocusSize = locusSize
-	newCls.Transcripts = make([]*gene.CodingTranscript, 0, 1)
+	newCls.Transcripts = make([]*InputTranscript, 0, 1)
 	return newCls
 }
 
 // Process group into clusters.
-func ProcessCache(cache []*gene.CodingTranscript, BoundaryTolerance, EndBoundaryTolerance int, clusterChan chan *TranscriptCluster) {
+func ProcessCache(cache []*InputTranscript, BoundaryTolerance, EndBoundaryTolerance int, deterministicIDs bool) []*TranscriptCluster {
 
 	// Slice to store clusters:
 	clusters := make([]*TranscriptCluster, 0, 100)
-	// Generate unique group id:
-	groupID := uuid.New().String()
+	// Generate group id:
+	groupID := GroupIdentifier(cache, deterministicIDs)
 	//L.Println(groupID, len(cache))
 	// For all transcript in cache:
 	for _, tr := range cache {
@@ -97,7 +240,7 @@ func ProcessCache(cache []*gene.CodingTranscript, BoundaryTolerance, EndBoundary
 		nrCls := searchClusters(tr, clusters, BoundaryTolerance, EndBoundaryTolerance)
 		if nrCls < 0 {
 			// No match found, create new cluster:
-			newCls := NewCluster(groupID, len(cache))
+			newCls := NewCluster(groupID, ClusterIdentifier(tr, deterministicIDs), len(cache))
 			newCls.Transcripts = append(newCls.Transcripts, tr)
 			clusters = append(clusters, newCls)
 		} else {
@@ -106,14 +249,137 @@ func ProcessCache(cache []*gene.CodingTranscript, BoundaryTolerance, EndBoundary
 		}
 	}
 
-	// Send out clusters:
+	return clusters
+}
+
+// Struct to hold transcripts sharing the same structure:
+type structureGroup struct {
+	key         string
+	transcripts []*InputTranscript
+}
+
+// Get the key of a transcript structure: orientation and exon boundaries.
+func structureKey(tr *InputTranscript) string {
+	fields := make([]string, 0, len(tr.Exons())+1)
+	fields = append(fields, fmt.Sprintf("%d", tr.Orient))
+	for _, exon := range tr.Exons() {
+		fields = append(fields, fmt.Sprintf("%d-%d", tr.Offset+exon.Start(), tr.Offset+exon.End()))
+	}
+	return strings.Join(fields, ":")
+}
+
+// Sum of exon boundary distances between two transcripts having the same number of exons.
+func structureDistance(a, b *InputTranscript) int {
+	var dist int
+	exonsB := b.Exons()
+	for i, ax := range a.Exons() {
+		bx := exonsB[i]
+		dist += Abs((a.Offset + ax.Start()) - (b.Offset + bx.Start()))
+		dist += Abs((a.Offset + ax.End()) - (b.Offset + bx.End()))
+	}
+	return dist
+}
+
+// Process group into clusters independently of the input order. Transcripts
+// having identical structures are collapsed, then the structures are processed
+// by decreasing support (ties broken by their coordinates). Each structure is
+// assigned to the closest cluster seed it is related to or seeds a new cluster.
+// As structures are only compared to seeds, chains of slightly shifted
+// transcripts cannot drift into a single cluster.
+func ProcessCacheSeeded(cache []*InputTranscript, BoundaryTolerance, EndBoundaryTolerance int, deterministicIDs bool) []*TranscriptCluster {
+
+	// Collapse identical structures:
+	groupsByKey := make(map[string]*structureGroup)
+	groups := make([]*structureGroup, 0, len(cache))
+	for _, tr := range cache {
+		key := structureKey(tr)
+		group, ok := groupsByKey[key]
+		if !ok {
+			group = &structureGroup{key: key}
+			groupsByKey[key] = group
+			groups = append(groups, group)
+		}
+		group.transcripts = append(group.transcripts, tr)
+	}
+
+	// Sort structures by decreasing support, then by coordinates:
+	sort.Slice(groups, func(i, j int) bool {
+		a, b := groups[i], groups[j]
+		if len(a.transcripts) != len(b.transcripts) {
+			return len(a.transcripts) > len(b.transcripts)
+		}
+		return a.key < b.key
+	})
+
+	// Generate group id:
+	groupID := GroupIdentifier(cache, deterministicIDs)
+
+	clusters := make([]*TranscriptCluster, 0, 100)
+	seeds := make([]*InputTranscript, 0, 100)
+	seedKeys := make([]string, 0, 100)
+	for _, group := range groups {
+		rep := group.transcripts[0]
+
+		// Search for the closest related seed:
+		best, bestDist := -1, 0
+		for i, seed := range seeds {
+			if !TranscriptsHardRelated(rep, seed, BoundaryTolerance, EndBoundaryTolerance) {
+				continue
+			}
+			if dist := structureDistance(rep, seed); best < 0 || dist < bestDist {
+				best, bestDist = i, dist
+			}
+		}
+
+		if best < 0 {
+			// No match found, seed new cluster:
+			newCls := NewCluster(groupID, ClusterIdentifier(rep, deterministicIDs), len(cache))
+			clusters = append(clusters, newCls)
+			seeds = append(seeds, rep)
+			seedKeys = append(seedKeys, group.key)
+			best = len(clusters) - 1
+		}
+		clusters[best].Transcripts = append(clusters[best].Transcripts, group.transcripts...)
+	}
+
+	// Sort cluster members by coordinates and identifiers:
 	for _, cls := range clusters {
-		clusterChan <- cls
+		trs := cls.Transcripts
+		sort.Slice(trs, func(i, j int) bool {
+			if trs[i].Start() != trs[j].Start() {
+				return trs[i].Start() < trs[j].Start()
+			}
+			if trs[i].End() != trs[j].End() {
+				return trs[i].End() < trs[j].End()
+			}
+			return trs[i].ID < trs[j].ID
+		})
+	}
+
+	// Order clusters by the coordinates of their seeds:
+	order := make([]int, len(clusters))
+	for i := range order {
+		order[i] = i
+	}
+	sort.Slice(order, func(i, j int) bool {
+		a, b := seeds[order[i]], seeds[order[j]]
+		if a.Start() != b.Start() {
+			return a.Start() < b.Start()
+		}
+		if a.End() != b.End() {
+			return a.End() < b.End()
+		}
+		return seedKeys[order[i]] < seedKeys[order[j]]
+	})
+	res := make([]*TranscriptCluster, len(clusters))
+	for i, j := range order {
+		res[i] = clusters[j]
 	}
+	return res
 }
 
 // Check wether transcript belongs to group:
-func SoftRelated(tr *gene.CodingTranscript, cache []*gene.CodingTranscript, EndBoundaryTolerance int) bool {
+func SoftRelated(tr *InputTranscript, cache []*InputTranscript, EndBoundaryTolerance int) bool {
 	// Empty cache, new transcript belong here:
 	if len(cache) == 0 {
 		return true
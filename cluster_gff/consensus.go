@@ -46,7 +46,7 @@ func MedianClusterConsensus(cluster *TranscriptCluster) *gene.CodingTranscript {
 	}
 
 	// Convert consensus boundaries to a gene.CodingTranscript object:
-	consTr := ExonStartEndToTranscript(consExonStarts, consExonEnds, cluster.Transcripts[0], cluster.ID, cluster.GroupID, len(cluster.Transcripts))
+	consTr := ExonStartEndToTranscript(consExonStarts, consExonEnds, cluster.Transcripts[0].CodingTranscript, cluster.ID, cluster.GroupID, len(cluster.Transcripts))
 
 	return consTr
 }
@@ -0,0 +1,163 @@
+package main
+
+import (
+	"sort"
+
+	"github.com/biogo/biogo/feat"
+	"github.com/google/uuid"
+)
+
+// Get the merged exonic intervals of the transcripts in a cluster.
+func clusterExons(cls *TranscriptCluster) [][2]int {
+	intervals := make([][2]int, 0, 10)
+	for _, tr := range cls.Transcripts {
+		for _, exon := range tr.Exons() {
+			intervals = append(intervals, [2]int{tr.Offset + exon.Start(), tr.Offset + exon.End()})
+		}
+	}
+	sort.Slice(intervals, func(i, j int) bool {
+		return intervals[i][0] < intervals[j][0]
+	})
+
+	merged := make([][2]int, 0, len(intervals))
+	for _, iv := range intervals {
+		last := len(merged) - 1
+		if last >= 0 && iv[0] <= merged[last][1] {
+			merged[last][1] = MaxInt(merged[last][1], iv[1])
+			continue
+		}
+		merged = append(merged, iv)
+	}
+	return merged
+}
+
+// Check whether two sorted slices of intervals share at least one base.
+func exonsOverlap(a, b [][2]int) bool {
+	i, j := 0, 0
+	for i < len(a) && j < len(b) {
+		if a[i][0] < b[j][1] && b[j][0] < a[i][1] {
+			return true
+		}
+		if a[i][1] < b[j][1] {
+			i++
+		} else {
+			j++
+		}
+	}
+	return false
+}
+
+// Find the root of a gene in the union-find forest.
+func findGene(parent []int, i int) int {
+	for parent[i] != i {
+		parent[i] = parent[parent[i]]
+		i = parent[i]
+	}
+	return i
+}
+
+// Generate a gene identifier: a random UUID or the span and strand of the gene.
+func GeneIdentifier(clusters []*TranscriptCluster, deterministic bool) string {
+	if !deterministic {
+		return uuid.New().String()
+	}
+	trs := make([]*InputTranscript, 0, len(clusters))
+	for _, cls := range clusters {
+		trs = append(trs, cls.Transcripts...)
+	}
+	return GroupIdentifier(trs, true) + ":" + strandString(trs[0].Orient)
+}
+
+// Group clusters into genes of clusters sharing exonic bases on the same
+// strand, unoriented clusters form genes on their own. The clusters get the
+// gene identifier as group ID and the number of transcripts in the gene (in
+// total and by sample) as locus size. The clusters are returned with the
+// clusters of each gene kept together, the genes ordered by their first cluster.
+func AssignGenes(clusters []*TranscriptCluster, deterministicIDs bool) []*TranscriptCluster {
+	exons := make([][][2]int, len(clusters))
+	parent := make([]int, len(clusters))
+	for i, cls := range clusters {
+		exons[i] = clusterExons(cls)
+		parent[i] = i
+	}
+
+	// Sort oriented clusters by chromosome, strand and start. Unoriented
+	// clusters have no strand and are left as genes on their own:
+	order := make([]int, 0, len(clusters))
+	for i, cls := range clusters {
+		if cls.Transcripts[0].Orient != feat.NotOriented {
+			order = append(order, i)
+		}
+	}
+	sort.Slice(order, func(i, j int) bool {
+		a, b := clusters[order[i]].Transcripts[0], clusters[order[j]].Transcripts[0]
+		if a.Location().Name() != b.Location().Name() {
+			return a.Location().Name() < b.Location().Name()
+		}
+		if a.Orient != b.Orient {
+			return a.Orient < b.Orient
+		}
+		return exons[order[i]][0][0] < exons[order[j]][0][0]
+	})
+
+	// Join clusters having overlapping exons, only comparing clusters with
+	// overlapping spans on the same chromosome and strand:
+	active := make([]int, 0, 100)
+	for k, i := range order {
+		if k > 0 {
+			a, b := clusters[i].Transcripts[0], clusters[order[k-1]].Transcripts[0]
+			if a.Location().Name() != b.Location().Name() || a.Orient != b.Orient {
+				active = active[:0]
+			}
+		}
+		start := exons[i][0][0]
+		kept := active[:0]
+		for _, j := range active {
+			// Drop clusters ending before the start of this one:
+			if exons[j][len(exons[j])-1][1] <= start {
+				continue
+			}
+			kept = append(kept, j)
+			if exonsOverlap(exons[i], exons[j]) {
+				parent[findGene(parent, i)] = findGene(parent, j)
+			}
+		}
+		active = append(kept, i)
+	}
+
+	// Collect genes in the order of their first cluster:
+	genes := make(map[int][]*TranscriptCluster)
+	roots := make([]int, 0, len(clusters))
+	for i, cls := range clusters {
+		root := findGene(parent, i)
+		if _, ok := genes[root]; !ok {
+			roots = append(roots, root)
+		}
+		genes[root] = append(genes[root], cls)
+	}
+
+	ordered := make([]*TranscriptCluster, 0, len(clusters))
+	for _, root := range roots {
+		members := genes[root]
+		ordered = append(ordered, members...)
+		geneID := GeneIdentifier(members, deterministicIDs)
+		if deterministicIDs && members[0].Transcripts[0].Orient == feat.NotOriented {
+			// Unoriented clusters are named by the cluster ID:
+			geneID = members[0].ID
+		}
+		size := 0
+		sampleSizes := make(map[string]int)
+		for _, cls := range members {
+			size += len(cls.Transcripts)
+			for sample, count := range sampleCounts(cls.Transcripts) {
+				sampleSizes[sample] += count
+			}
+		}
+		for _, cls := range members {
+			cls.GroupID = geneID
+			cls.LocusSize = size
+			cls.SampleLocusSizes = sampleSizes
+		}
+	}
+	return ordered
+}
@@ -0,0 +1,165 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/biogo/biogo/feat"
+	"github.com/biogo/biogo/feat/gene"
+	"github.com/biogo/biogo/io/featio/gff"
+)
+
+// Transcript buffered together with its extra attributes:
+type bufferedTranscript struct {
+	tr    *gene.CodingTranscript
+	attrs gff.Attributes
+}
+
+// Transcript writer producing GTF 2.2 or GFF3 output, grouping consecutive
+// transcripts with the same gene ID under a gene feature:
+type HierTranscriptWriter struct {
+	out    *bufio.Writer
+	format string
+	geneID string
+	buffer []bufferedTranscript
+}
+
+// Create new GTF or GFF3 transcript writer.
+func NewHierTranscriptWriter(out io.Writer, format string) *HierTranscriptWriter {
+	w := &HierTranscriptWriter{
+		out:    bufio.NewWriter(out),
+		format: format,
+		buffer: make([]bufferedTranscript, 0, 10),
+	}
+	if format == FormatGFF3 {
+		w.out.WriteString("##gff-version 3\n")
+	}
+	return w
+}
+
+// Buffer transcript until all transcripts of its gene are seen.
+func (w *HierTranscriptWriter) Write(tr *gene.CodingTranscript, attrs gff.Attributes) {
+	geneID, _, _ := transcriptInfo(tr)
+	if geneID != w.geneID && len(w.buffer) > 0 {
+		w.writeGene()
+	}
+	w.geneID = geneID
+	w.buffer = append(w.buffer, bufferedTranscript{tr, attrs})
+}
+
+// Write out the last gene and flush buffered output.
+func (w *HierTranscriptWriter) Flush() {
+	if len(w.buffer) > 0 {
+		w.writeGene()
+	}
+	if err := w.out.Flush(); err != nil {
+		L.Fatalf("Failed to flush %s output: %s\n", w.format, err)
+	}
+}
+
+// Write out the buffered gene and its transcripts.
+func (w *HierTranscriptWriter) writeGene() {
+	first := w.buffer[0].tr
+	start, end, orient := first.Start(), first.End(), first.Orient
+	for _, bt := range w.buffer[1:] {
+		tr := bt.tr
+		if tr.Start() < start {
+			start = tr.Start()
+		}
+		if tr.End() > end {
+			end = tr.End()
+		}
+		// Genes with transcripts on both strands are not oriented:
+		if tr.Orient != orient {
+			orient = feat.NotOriented
+		}
+	}
+
+	w.writeLine(first.Location().Name(), "gene", start, end, nil, orient, w.geneAttributes())
+	for _, bt := range w.buffer {
+		w.writeTranscript(bt.tr, bt.attrs)
+	}
+
+	w.buffer = w.buffer[:0]
+}
+
+// Write out transcript and exon lines.
+func (w *HierTranscriptWriter) writeTranscript(tr *gene.CodingTranscript, attrs gff.Attributes) {
+	geneID, trID, score := transcriptInfo(tr)
+	chrom := tr.Location().Name()
+
+	var trFeature string
+	switch w.format {
+	case FormatGTF:
+		trFeature = "transcript"
+	case FormatGFF3:
+		trFeature = "mRNA"
+	}
+	w.writeLine(chrom, trFeature, tr.Start(), tr.End(), score, tr.Orient, w.transcriptAttributes(geneID, trID, attrs))
+
+	// Exons are numbered in the direction of transcription:
+	exons := tr.Exons()
+	for i, exon := range exons {
+		exonNr := i + 1
+		if tr.Orient == feat.Reverse {
+			exonNr = len(exons) - i
+		}
+		w.writeLine(chrom, "exon", tr.Offset+exon.Start(), tr.Offset+exon.End(), score, tr.Orient, w.exonAttributes(geneID, trID, exonNr))
+	}
+}
+
+// Format gene attributes.
+func (w *HierTranscriptWriter) geneAttributes() string {
+	if w.format == FormatGFF3 {
+		return "ID=gene:" + escapeGFF3(w.geneID)
+	}
+	return fmt.Sprintf("gene_id \"%s\";", w.geneID)
+}
+
+// Format transcript attributes, including the extra attributes.
+func (w *HierTranscriptWriter) transcriptAttributes(geneID, trID string, attrs gff.Attributes) string {
+	if w.format == FormatGFF3 {
+		res := fmt.Sprintf("ID=transcript:%s;Parent=gene:%s", escapeGFF3(trID), escapeGFF3(geneID))
+		for _, attr := range attrs {
+			res += fmt.Sprintf(";%s=%s", attr.Tag, escapeGFF3(attr.Value))
+		}
+		return res
+	}
+	res := fmt.Sprintf("gene_id \"%s\"; transcript_id \"%s\";", geneID, trID)
+	for _, attr := range attrs {
+		res += fmt.Sprintf(" %s %s;", attr.Tag, quoteValue(attr.Value))
+	}
+	return res
+}
+
+// Format exon attributes.
+func (w *HierTranscriptWriter) exonAttributes(geneID, trID string, exonNr int) string {
+	if w.format == FormatGFF3 {
+		return fmt.Sprintf("Parent=transcript:%s;exon_number=%d", escapeGFF3(trID), exonNr)
+	}
+	return fmt.Sprintf("gene_id \"%s\"; transcript_id \"%s\"; exon_number \"%d\";", geneID, trID, exonNr)
+}
+
+// Write a single GTF/GFF3 line.
+func (w *HierTranscriptWriter) writeLine(chrom, feature string, start, end int, score *float64, orient feat.Orientation, attributes string) {
+	scoreStr := "."
+	if score != nil {
+		scoreStr = strconv.FormatFloat(*score, 'f', -1, 64)
+	}
+	_, err := fmt.Fprintf(w.out, "%s\tpinfish\t%s\t%d\t%d\t%s\t%s\t.\t%s\n", chrom, feature, start+1, end, scoreStr, strandString(orient), attributes)
+	if err != nil {
+		L.Fatalf("Failed to write %s line: %s\n", w.format, err)
+	}
+}
+
+// Escape reserved characters in GFF3 attribute values.
+func escapeGFF3(s string) string {
+	if !strings.ContainsAny(s, ";=&,%\t\n") {
+		return s
+	}
+	return strings.Replace(url.QueryEscape(s), "+", "%20", -1)
+}
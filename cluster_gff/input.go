@@ -8,6 +8,9 @@ import (
 	"os"
 )
 
+// Maximum number of consecutive unparsable lines before giving up on the input:
+const maxReadErrors = 1000
+
 // Create new GFF reader from file.
 func NewGFFReader(gffFile string) *gff.Reader {
 	fh, err := os.Open(gffFile)
@@ -19,63 +22,98 @@ func NewGFFReader(gffFile string) *gff.Reader {
 	return reader
 }
 
-// Read transcripts from input files.
-func ReadTranscripts(InputFiles []string) chan *gene.CodingTranscript {
+// Read transcripts from an input file (or standard input if empty), labeling
+// them by sample. Malformed transcripts are passed to the error handler.
+func ReadTranscripts(inputFile string, sample string, errHandler *ErrorHandler) chan *InputTranscript {
 
 	// Output channel:
-	relChan := make(chan *gene.CodingTranscript, 1000)
+	relChan := make(chan *InputTranscript, 1000)
 
 	go func() {
 		var gffReader *gff.Reader
 
 		// Create GFF reader from file or Stdin:
-		if len(InputFiles) > 0 {
-			gffReader = NewGFFReader(InputFiles[0])
+		if inputFile != "" {
+			gffReader = NewGFFReader(inputFile)
 		} else {
 			gffReader = gff.NewReader(bufio.NewReader(os.Stdin))
 		}
 
-		var currTr *gene.CodingTranscript // Current transcript.
-		exons := make(gene.Exons, 0)      // Exon cache.
+		var currTr *InputTranscript  // Current transcript.
+		var currFeats []*gff.Feature // Features of the current transcript.
+		exons := make(gene.Exons, 0) // Exon cache.
+		readErrors := 0              // Consecutive read errors.
+		skipping := false            // Skipping the exons of a malformed transcript.
+
+		// Set exons of the current transcript and process it:
+		sendTranscript := func() {
+			if currTr == nil {
+				return
+			}
+			err := currTr.SetExons(exons...)
+			if err != nil {
+				errHandler.Handle(NewRecordError(ErrExons, "Failed to set exons for %s: %s", currTr.ID, err), currFeats...)
+				return
+			}
+			relChan <- currTr
+		}
 
 		for {
 			// Get next feature:
 			feat, err := gffReader.Read()
 
 			if err == io.EOF {
-				// Set exons for last transcript:
-				err := currTr.SetExons(exons...)
-				if err != nil {
-					L.Fatal("Failed to set exons for: %s\n", currTr.ID)
-				}
-				relChan <- currTr
+				// Process last transcript:
+				sendTranscript()
 				break
 
 			} else if err != nil {
-				// Read error:
-				L.Fatalf("Failed to read feature: %s\n", err)
+				// Give up if the reader does not advance past unparsable lines:
+				readErrors++
+				if readErrors > maxReadErrors {
+					L.Fatalf("Failed to read feature: %s\n", err)
+				}
+				// Drop the current transcript, which may be missing the line:
+				errHandler.Handle(NewRecordError(ErrParse, "Failed to read feature: %s", err), currFeats...)
+				currTr, currFeats = nil, nil
+				skipping = true
+				continue
 			}
+			readErrors = 0
 
 			gffFeat, _ := feat.(*gff.Feature)
 
 			switch gffFeat.Feature {
-			case "mRNA":
-				// Add exons to current transcript and process it:
-				if currTr != nil {
-					err := currTr.SetExons(exons...)
-					if err != nil {
-						L.Fatal("Failed to set exons for: %s\n", currTr.ID)
-					}
-					// Process transcript:
-					relChan <- currTr
-				}
+			case "mRNA", "transcript":
+				// Process previous transcript:
+				sendTranscript()
 				// Update current transcript and empty exon cache:
 				currTr = Feat2NewCodingTranscript(gffFeat)
+				// Label transcript by sample:
+				currTr.Sample = sample
+				currFeats = []*gff.Feature{gffFeat}
 				exons = make(gene.Exons, 0)
+				skipping = false
 			case "exon":
+				if skipping {
+					errHandler.Reject(gffFeat)
+					continue
+				}
+				if currTr == nil {
+					errHandler.Handle(NewRecordError(ErrOrphanExon, "Exon preceding the first transcript: %s", gffFeat.FeatAttributes.Get("transcript_id")), gffFeat)
+					continue
+				}
 				// Add exon to cache:
-				exon := Feat2NewExon(gffFeat, currTr)
+				exon, err := Feat2NewExon(gffFeat, currTr.CodingTranscript)
+				if err != nil {
+					// Drop the current transcript:
+					errHandler.Handle(err, append(currFeats, gffFeat)...)
+					currTr, currFeats = nil, nil
+					skipping = true
+					continue
+				}
 				exons = append(exons, exon)
+				currFeats = append(currFeats, gffFeat)
 			default:
 				continue // Ignore all other feature types.
 
@@ -36,26 +36,76 @@ func main() {
 		clustersTabOut = CreateTabOut(args.ClustersOut)
 	}
 
-	// Create new GFF writer on standard output:
-	gffWriter := gff.NewWriter(os.Stdout, 1000, true)
+	// Create per-cell counts output:
+	var cellCountsOut io.Writer
+	if args.CellCountsOut != "" {
+		cellCountsOut = CreateCellCountsOut(args.CellCountsOut)
+	}
+
+	// Create new transcript writer on standard output:
+	trWriter := NewTranscriptWriter(os.Stdout, args.OutFormat)
+
+	// Load reference genome for splice site motif annotation:
+	var genome *RefGenome
+	if args.RefGenome != "" {
+		genome = LoadRefGenome(args.RefGenome)
+	}
+
+	// Request channels with input transcripts labeled by sample and merge them:
+	errHandler := NewErrorHandler(args.ErrorPolicy, args.RejectsOut)
+	var trsChan chan *InputTranscript
+	if len(args.InputFiles) > 0 {
+		trStreams := make([]chan *InputTranscript, len(args.InputFiles))
+		for i, inputFile := range args.InputFiles {
+			trStreams[i] = ReadTranscripts(inputFile, args.Samples[i], errHandler)
+		}
+		trsChan = MergeTranscripts(trStreams)
+	} else {
+		trsChan = ReadTranscripts("", args.Samples[0], errHandler)
+	}
+
+	// Create count matrix output:
+	var matrixOut *os.File
+	if args.MatrixOut != "" {
+		matrixOut = CreateCountMatrixOut(args.MatrixOut, args.Samples)
+	}
 
-	// Request channel with input transcripts:
-	trsChan := ReadTranscripts(args.InputFiles)
 	// Produce clusters of input transcripts:
 
-	clusterChan := ClusterTranscriptStream(trsChan, int(args.BoundaryTolerance), int(args.EndBoundaryTolerance))
+	clusterChan := ClusterTranscriptStream(trsChan, int(args.BoundaryTolerance), int(args.EndBoundaryTolerance), args.Algorithm, args.DeterministicIDs, args.GeneGrouping, int(args.MaxProcs))
 
 	for cluster := range clusterChan {
 		// Select clusters with enough coverage:
-		if cluster.IsoPercent() >= args.MinIsoPercent && len(cluster.Transcripts) >= int(args.MinCoverage) {
+		if cluster.PassesThresholds(int(args.MinCoverage), args.MinIsoPercent, args.PerSample) {
 			if clustersTabOut != nil {
 				WriteClusterTab(cluster, clustersTabOut)
 			}
+			if matrixOut != nil {
+				WriteCountMatrixRow(cluster, args.Samples, matrixOut)
+			}
+			if cellCountsOut != nil {
+				WriteCellCounts(cluster, cellCountsOut)
+			}
 			// Generate cluster consensus:
 			consTr := MedianClusterConsensus(cluster)
+			// Annotate splice site motifs:
+			var attrs gff.Attributes
+			if genome != nil {
+				attrs = MotifAttributes(consTr, TranscriptMotifs(consTr, genome))
+			}
 			// Write out cluster consensus:
-			consGFF := Transcript2GFF(consTr)
-			writeGFFs(gffWriter, consGFF)
+			trWriter.Write(consTr, attrs)
 		}
 	}
+
+	// Flush buffered output:
+	trWriter.Flush()
+
+	// Close count matrix output:
+	if matrixOut != nil {
+		matrixOut.Close()
+	}
+
+	// Report malformed transcripts:
+	errHandler.Close()
 }
@@ -1,11 +1,7 @@
 package main
 
-import (
-	"github.com/biogo/biogo/feat/gene"
-)
-
 // Decide wether the transcript start sites are close enough:
-func TranscriptsSoftRelated(a, b *gene.CodingTranscript, EndBoundaryTolerance int) bool {
+func TranscriptsSoftRelated(a, b *InputTranscript, EndBoundaryTolerance int) bool {
 	// Mismatching chromosomes:
 	if a.Loc.Name() != b.Loc.Name() {
 		return false
@@ -19,7 +15,7 @@ func TranscriptsSoftRelated(a, b *gene.CodingTranscript, EndBoundaryTolerance in
 }
 
 // Decide wether two transcripts belong to the same cluster:
-func TranscriptsHardRelated(a, b *gene.CodingTranscript, BoundaryTolerance, EndBoundaryTolerance int) bool {
+func TranscriptsHardRelated(a, b *InputTranscript, BoundaryTolerance, EndBoundaryTolerance int) bool {
 
 	// Mismatching orientation: // Treat here not oriented as match?
 	if a.Orientation() != b.Orientation() {
@@ -0,0 +1,131 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Generate sample labels from input file names by stripping the directory and extension.
+func SampleLabels(inputFiles []string) []string {
+	labels := make([]string, len(inputFiles))
+	for i, file := range inputFiles {
+		base := filepath.Base(file)
+		labels[i] = strings.TrimSuffix(base, filepath.Ext(base))
+	}
+	return labels
+}
+
+// Count transcripts by sample.
+func sampleCounts(trs []*InputTranscript) map[string]int {
+	counts := make(map[string]int)
+	for _, tr := range trs {
+		counts[tr.Sample]++
+	}
+	return counts
+}
+
+// Merge sorted transcript streams into a single stream sorted by start
+// position. The inputs must list the chromosomes in the same order.
+func MergeTranscripts(trStreams []chan *InputTranscript) chan *InputTranscript {
+	if len(trStreams) == 1 {
+		return trStreams[0]
+	}
+
+	// Output channel:
+	mergedChan := make(chan *InputTranscript, 1000)
+
+	go func() {
+		heads := make([]*InputTranscript, len(trStreams))
+		for i, trStream := range trStreams {
+			heads[i] = <-trStream
+		}
+		chromRanks := make(map[string]int) // Chromosomes ranked by first appearance.
+		var currChrom string
+
+		for {
+			// Rank chromosomes of new heads:
+			for _, head := range heads {
+				if head == nil {
+					continue
+				}
+				if _, ok := chromRanks[head.Location().Name()]; !ok {
+					chromRanks[head.Location().Name()] = len(chromRanks)
+				}
+			}
+
+			// Select the next transcript, preferring the current chromosome:
+			next := -1
+			for i, head := range heads {
+				if head == nil {
+					continue
+				}
+				if next < 0 {
+					next = i
+					continue
+				}
+				best := heads[next]
+				chrom, bestChrom := head.Location().Name(), best.Location().Name()
+				switch {
+				case chrom == bestChrom:
+					if head.Start() < best.Start() {
+						next = i
+					}
+				case chrom == currChrom:
+					next = i
+				case bestChrom != currChrom && chromRanks[chrom] < chromRanks[bestChrom]:
+					next = i
+				}
+			}
+			// All inputs exhausted:
+			if next < 0 {
+				break
+			}
+
+			currChrom = heads[next].Location().Name()
+			mergedChan <- heads[next]
+			heads[next] = <-trStreams[next]
+		}
+
+		close(mergedChan)
+	}()
+
+	return mergedChan
+}
+
+// Decide whether a cluster passes the minimum size and isoform percentage
+// thresholds, either on total support or in at least one of the samples.
+func (tc TranscriptCluster) PassesThresholds(minCoverage int, minIsoPercent float64, perSample bool) bool {
+	if !perSample {
+		return tc.IsoPercent() >= minIsoPercent && len(tc.Transcripts) >= minCoverage
+	}
+	for sample, count := range sampleCounts(tc.Transcripts) {
+		isoPercent := (100.0 * float64(count)) / float64(tc.SampleLocusSizes[sample])
+		if isoPercent >= minIsoPercent && count >= minCoverage {
+			return true
+		}
+	}
+	return false
+}
+
+// Create count matrix output and write header.
+func CreateCountMatrixOut(matrixOut string, samples []string) *os.File {
+	fh, err := os.Create(matrixOut)
+	if err != nil {
+		L.Fatalf("Could not create count matrix output %s: %s", matrixOut, err)
+	}
+	fmt.Fprintf(fh, "Transcript\tGene\t%s\n", strings.Join(samples, "\t"))
+	return fh
+}
+
+// Write the number of transcripts supporting a cluster in each sample.
+func WriteCountMatrixRow(cluster *TranscriptCluster, samples []string, matrixOut io.Writer) {
+	counts := sampleCounts(cluster.Transcripts)
+	row := make([]string, len(samples))
+	for i, sample := range samples {
+		row[i] = fmt.Sprintf("%d", counts[sample])
+	}
+	fmt.Fprintf(matrixOut, "%s\t%s\t%s\n", cluster.ID, cluster.GroupID, strings.Join(row, "\t"))
+}
@@ -10,8 +10,16 @@ import (
 	"strings"
 )
 
-// Convert GFF feature into gene.CodingTranscript
-func Feat2NewCodingTranscript(feature *gff.Feature) *gene.CodingTranscript {
+// Struct to hold an input transcript and its metadata:
+type InputTranscript struct {
+	*gene.CodingTranscript
+	Cell   string // Cell barcode.
+	UMI    string // Unique molecular identifier.
+	Sample string // Sample label of the input file.
+}
+
+// Convert GFF feature into an input transcript, keeping cell barcode and UMI as metadata.
+func Feat2NewCodingTranscript(feature *gff.Feature) *InputTranscript {
 
 	ch := &genome.Chromosome{
 		Chr:      feature.SeqName,
@@ -32,16 +40,20 @@ func Feat2NewCodingTranscript(feature *gff.Feature) *gene.CodingTranscript {
 		CDSend:   0,
 	}
 
-	return tr
+	return &InputTranscript{
+		CodingTranscript: tr,
+		Cell:             unquote(feature.FeatAttributes.Get("cell_barcode")),
+		UMI:              unquote(feature.FeatAttributes.Get("umi")),
+	}
 }
 
 // Convert GFF feature to a gene.Exon object
-func Feat2NewExon(feature *gff.Feature, tr *gene.CodingTranscript) gene.Exon {
+func Feat2NewExon(feature *gff.Feature, tr *gene.CodingTranscript) (gene.Exon, *RecordError) {
 
 	exonTrId := feature.FeatAttributes.Get("transcript_id")
 	// Check for transcript/exon mismatch:
 	if exonTrId != tr.Name() {
-		L.Fatalf("Exon/Transcript mismatch! Exon transcript id: %s Transcript id: %s\n", exonTrId, tr.Name())
+		return gene.Exon{}, NewRecordError(ErrExonMismatch, "Exon/Transcript mismatch! Exon transcript id: %s Transcript id: %s", exonTrId, tr.Name())
 	}
 	exonId := feature.FeatAttributes.Get("exon_id")
 
@@ -52,17 +64,23 @@ func Feat2NewExon(feature *gff.Feature, tr *gene.CodingTranscript) gene.Exon {
 		Desc:       exonId,
 	}
 
-	return exon
+	return exon, nil
 }
 
-// Convert a gene.CodingTranscript object into a slice of gff.Feature objects.
-func Transcript2GFF(tr *gene.CodingTranscript) []gff.Feature {
+// Parse out group ID and cluster size from transcript description.
+func parseDesc(desc string) (string, int) {
+	descTmp := strings.Split(desc, "\n")
+	desc, clStr := descTmp[0], descTmp[1]
+	clSize, _ := strconv.Atoi(clStr)
+	return desc, clSize
+}
+
+// Convert a gene.CodingTranscript object into a slice of gff.Feature objects. Extra attributes are attached to the mRNA feature.
+func Transcript2GFF(tr *gene.CodingTranscript, extraAttrs gff.Attributes) []gff.Feature {
 	res := make([]gff.Feature, 0, len(tr.Exons())+1)
 
 	// Extract gene ID and cluster size from description:
-	descTmp := strings.Split(tr.Desc, "\n")
-	desc, clStr := descTmp[0], descTmp[1]
-	clSize, _ := strconv.Atoi(clStr)
+	desc, clSize := parseDesc(tr.Desc)
 	// The cluster size will serve as feature score:
 	clSizeF := float64(clSize)
 
@@ -76,7 +94,7 @@ func Transcript2GFF(tr *gene.CodingTranscript) []gff.Feature {
 		FeatScore:      &clSizeF,
 		FeatStrand:     seq.Strand(tr.Orient),
 		FeatFrame:      gff.NoFrame,
-		FeatAttributes: gff.Attributes{gff.Attribute{Tag: "gene_id", Value: "\"" + desc + "\""}, gff.Attribute{Tag: "transcript_id", Value: "\"" + tr.ID + "\";"}},
+		FeatAttributes: gff2Attributes(gff.Attributes{gff.Attribute{Tag: "gene_id", Value: "\"" + desc + "\""}, gff.Attribute{Tag: "transcript_id", Value: "\"" + tr.ID + "\""}}, extraAttrs),
 	}
 
 	res = append(res, trFeat)
@@ -7,3 +7,19 @@ func Abs(i int) int {
 	}
 	return i
 }
+
+// Remove surrounding double quotes from a GFF attribute value.
+func unquote(s string) string {
+	if len(s) >= 2 && s[0] == '"' && s[len(s)-1] == '"' {
+		return s[1 : len(s)-1]
+	}
+	return s
+}
+
+// Return the larger of two integers.
+func MaxInt(a, b int) int {
+	if a > b {
+		return a
+	}
+	return b
+}
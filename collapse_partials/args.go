@@ -18,6 +18,10 @@ type CmdArgs struct {
 	MonoDiscard       bool
 	UnorientDiscard   bool
 	ProfFile          string
+	ErrorPolicy       string
+	RejectsOut        string
+	OutFormat         string
+	DeterministicIDs  bool
 }
 
 // Parse command line arguments using the flag package.
@@ -30,6 +34,10 @@ func (a *CmdArgs) Parse() {
 	flag.Int64Var(&a.FiveTolerance, "f", 5000, "Five prime exons boundary tolerance.")
 	flag.BoolVar(&a.MonoDiscard, "M", false, "Discard monoexonic transcripts.")
 	flag.BoolVar(&a.UnorientDiscard, "U", false, "Discard transcripts which are not oriented.")
+	flag.BoolVar(&a.DeterministicIDs, "D", false, "Derive locus identifiers from the 3' end coordinates instead of random UUIDs and assign transcripts to the closest locus.")
+	flag.StringVar(&a.OutFormat, "F", FormatGFF2, "Output format (gff2, gtf, gff3 or bed12).")
+	flag.StringVar(&a.ErrorPolicy, "E", PolicyStrict, "Policy for malformed transcripts (strict, skip or warn).")
+	flag.StringVar(&a.RejectsOut, "X", "", "Write features of skipped malformed transcripts to this file.")
 	flag.BoolVar(&help, "h", false, "Print out help message.")
 	flag.Int64Var(&a.MaxProcs, "t", 4, "Number of cores to use.")
 	flag.StringVar(&a.ProfFile, "prof", "", "Write out CPU profiling information.")
@@ -51,4 +59,10 @@ func (a *CmdArgs) Parse() {
 	a.InputFiles = flag.Args()
 
 	//Check parameters:
+	if !ValidPolicy(a.ErrorPolicy) {
+		L.Fatalf("Unsupported error policy: %s\n", a.ErrorPolicy)
+	}
+	if !ValidFormat(a.OutFormat) {
+		L.Fatalf("Unsupported output format: %s\n", a.OutFormat)
+	}
 }
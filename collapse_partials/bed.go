@@ -0,0 +1,72 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/biogo/biogo/feat"
+	"github.com/biogo/biogo/feat/gene"
+)
+
+// Transcript writer producing BED12 output:
+type BEDTranscriptWriter struct {
+	out *bufio.Writer
+}
+
+// Create new BED12 transcript writer.
+func NewBEDTranscriptWriter(out io.Writer) *BEDTranscriptWriter {
+	return &BEDTranscriptWriter{bufio.NewWriter(out)}
+}
+
+// Write transcript as a BED12 line, using the cluster size as score.
+func (w *BEDTranscriptWriter) Write(tr *gene.CodingTranscript) {
+	_, clSize := parseDesc(tr.Desc)
+	_, err := w.out.WriteString(Transcript2BED(tr, unquote(tr.ID), clSize))
+	if err != nil {
+		L.Fatalf("Failed to write BED record for %s: %s\n", tr.ID, err)
+	}
+}
+
+// Flush buffered BED records.
+func (w *BEDTranscriptWriter) Flush() {
+	if err := w.out.Flush(); err != nil {
+		L.Fatalf("Failed to flush BED output: %s\n", err)
+	}
+}
+
+// Convert a gene.CodingTranscript object into a BED12 line.
+func Transcript2BED(tr *gene.CodingTranscript, name string, score int) string {
+	start, end := tr.Start(), tr.End()
+
+	// Use CDS as thick part if known:
+	thickStart, thickEnd := start, start
+	if tr.CDSend > tr.CDSstart {
+		thickStart, thickEnd = start+tr.CDSstart, start+tr.CDSend
+	}
+
+	// Exons are the BED blocks:
+	exons := tr.Exons()
+	sizes := make([]string, len(exons))
+	starts := make([]string, len(exons))
+	for i, exon := range exons {
+		sizes[i] = fmt.Sprintf("%d", exon.Len())
+		starts[i] = fmt.Sprintf("%d", tr.Offset+exon.Start()-start)
+	}
+
+	return fmt.Sprintf("%s\t%d\t%d\t%s\t%d\t%s\t%d\t%d\t0\t%d\t%s,\t%s,\n",
+		tr.Location().Name(), start, end, name, score, strandString(tr.Orient),
+		thickStart, thickEnd, len(exons), strings.Join(sizes, ","), strings.Join(starts, ","))
+}
+
+// Convert orientation into a strand string.
+func strandString(orient feat.Orientation) string {
+	switch orient {
+	case feat.Forward:
+		return "+"
+	case feat.Reverse:
+		return "-"
+	}
+	return "."
+}
@@ -0,0 +1,130 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"sort"
+
+	"github.com/biogo/biogo/io/featio/gff"
+)
+
+// Policies for handling malformed features:
+const (
+	PolicyStrict = "strict" // Abort on the first malformed feature.
+	PolicySkip   = "skip"   // Skip and count malformed transcripts.
+	PolicyWarn   = "warn"   // Skip and count malformed transcripts, logging a warning for each.
+)
+
+// Types of malformed features:
+const (
+	ErrExonMismatch = "exon_transcript_mismatch"
+	ErrOrphanExon   = "orphan_exon"
+	ErrExons        = "invalid_exons"
+	ErrParse        = "unparsable_line"
+)
+
+// Struct to hold the error raised by a malformed feature:
+type RecordError struct {
+	Type string
+	Msg  string
+}
+
+func (e *RecordError) Error() string {
+	return e.Msg
+}
+
+// Create a new record error of the specified type.
+func NewRecordError(errType string, format string, args ...interface{}) *RecordError {
+	return &RecordError{Type: errType, Msg: fmt.Sprintf(format, args...)}
+}
+
+// Check whether the error policy is supported.
+func ValidPolicy(policy string) bool {
+	switch policy {
+	case PolicyStrict, PolicySkip, PolicyWarn:
+		return true
+	}
+	return false
+}
+
+// Struct to handle malformed features according to the error policy:
+type ErrorHandler struct {
+	Policy     string
+	Counts     map[string]int // Number of malformed records by error type.
+	fh         *os.File
+	rejects    *bufio.Writer
+	gffRejects *gff.Writer
+}
+
+// Create a new error handler, writing the rejected features to a file if specified.
+func NewErrorHandler(policy string, rejectsFile string) *ErrorHandler {
+	h := &ErrorHandler{Policy: policy, Counts: make(map[string]int)}
+	if rejectsFile != "" {
+		fh, err := os.Create(rejectsFile)
+		if err != nil {
+			L.Fatalf("Could not create rejects file %s: %s\n", rejectsFile, err)
+		}
+		h.fh, h.rejects = fh, bufio.NewWriter(fh)
+		h.gffRejects = gff.NewWriter(h.rejects, 1000, true)
+	}
+	return h
+}
+
+// Handle a malformed transcript: abort under the strict policy, otherwise count
+// the error and write the features of the transcript to the rejects file.
+// Not safe for concurrent use.
+func (h *ErrorHandler) Handle(err *RecordError, features ...*gff.Feature) {
+	switch h.Policy {
+	case PolicyStrict:
+		L.Fatalf("%s\n", err)
+	case PolicyWarn:
+		L.Printf("Skipping malformed transcript: %s\n", err)
+	}
+	h.Counts[err.Type]++
+	h.reject(features)
+}
+
+// Write further features of an already handled transcript to the rejects file.
+// Not safe for concurrent use.
+func (h *ErrorHandler) Reject(features ...*gff.Feature) {
+	h.reject(features)
+}
+
+// Write features to the rejects file, if any:
+func (h *ErrorHandler) reject(features []*gff.Feature) {
+	if h.gffRejects == nil {
+		return
+	}
+	for _, feature := range features {
+		if _, werr := h.gffRejects.Write(feature); werr != nil {
+			L.Fatalf("Failed to write rejects file: %s\n", werr)
+		}
+	}
+}
+
+// Close the rejects file and log the number of malformed features by error type.
+func (h *ErrorHandler) Close() {
+	if h.rejects != nil {
+		if err := h.rejects.Flush(); err != nil {
+			L.Fatalf("Failed to write rejects file: %s\n", err)
+		}
+		h.fh.Close()
+	}
+
+	if len(h.Counts) == 0 {
+		return
+	}
+	types := make([]string, 0, len(h.Counts))
+	var total int
+	for errType, count := range h.Counts {
+		types = append(types, errType)
+		total += count
+	}
+	sort.Strings(types)
+
+	L.Printf("Malformed features skipped: %d\n", total)
+	for _, errType := range types {
+		L.Printf("\t%s: %d\n", errType, h.Counts[errType])
+	}
+}
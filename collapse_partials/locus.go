@@ -5,6 +5,7 @@ import (
 	"github.com/biogo/biogo/feat/gene"
 	"github.com/google/uuid"
 	"math"
+	"strconv"
 )
 
 // Structure to hold a 3' locus:
@@ -34,7 +35,8 @@ func GetThreePrime(tr *gene.CodingTranscript) int {
 }
 
 // Look for a compatible 3' locus in the pool based on the distance from the locus mean position.
-func SearchLoci(tr *gene.CodingTranscript, pool LocusPool, threeTol int) (Locus, bool) {
+// The first compatible locus is returned, or the closest one if requested.
+func SearchLoci(tr *gene.CodingTranscript, pool LocusPool, threeTol int, closest bool) (Locus, bool) {
 	// Empty pool, nothing found:
 	if len(pool) == 0 {
 		return Locus{}, false
@@ -47,6 +49,8 @@ func SearchLoci(tr *gene.CodingTranscript, pool LocusPool, threeTol int) (Locus,
 	}
 
 	// Check each locus for compatibility:
+	var best Locus
+	bestDelta := -1.0
 	for locus, _ := range pool {
 		// Chromosome mistmatch:
 		if locus.Chrom != tr.Location().Name() {
@@ -61,17 +65,42 @@ func SearchLoci(tr *gene.CodingTranscript, pool LocusPool, threeTol int) (Locus,
 		delta := math.Abs(float64(GetThreePrime(tr)) - locus.ThreePrime)
 
 		// Apply 3' tolerance:
-		if delta < float64(threeTol) {
+		if delta >= float64(threeTol) {
+			continue
+		}
+		if !closest {
 			return locus, true
 		}
+		// Break ties by locus id to make the choice independent of the pool order:
+		if bestDelta < 0 || delta < bestDelta || (delta == bestDelta && locus.Id < best.Id) {
+			best, bestDelta = locus, delta
+		}
+	}
+	return best, bestDelta >= 0
+}
 
+// Generate a locus id: a random UUID or the chromosome, 1-based 3' position
+// and strand of the founding transcript, made unique by a counter if needed.
+func locusIdentifier(tr *gene.CodingTranscript, usedIDs map[string]int, deterministic bool) string {
+	if !deterministic {
+		return uuid.New().String()
+	}
+	pos := GetThreePrime(tr)
+	if tr.Orient != feat.Forward {
+		pos++
+	}
+	id := tr.Location().Name() + ":" + strconv.Itoa(pos) + ":" + strandString(tr.Orient)
+	usedIDs[id]++
+	if n := usedIDs[id]; n > 1 {
+		id += "." + strconv.Itoa(n)
 	}
-	return Locus{}, false
+	return id
 }
 
 // Load transcriopt into loci defined by the 3' ends.
-func LoadLoci(trsChan chan *gene.CodingTranscript, threeTol int, monoDiscard bool, unorientDiscard bool) LocusPool {
+func LoadLoci(trsChan chan *gene.CodingTranscript, threeTol int, monoDiscard bool, unorientDiscard bool, deterministicIDs bool) LocusPool {
 	locusPool := make(LocusPool)
+	usedIDs := make(map[string]int)
 
 	for tr := range trsChan {
 		// Discard monoexonic transcripts if requested:
@@ -83,12 +112,12 @@ func LoadLoci(trsChan chan *gene.CodingTranscript, threeTol int, monoDiscard boo
 			continue
 		}
 
-		// Search for the first compatible locus:
-		locus, found := SearchLoci(tr, locusPool, threeTol)
+		// Search for a compatible locus, the closest one when using deterministic ids:
+		locus, found := SearchLoci(tr, locusPool, threeTol, deterministicIDs)
 
 		if !found {
 			// New locus:
-			newLocus := Locus{tr.Location().Name(), tr.Orient, float64(GetThreePrime(tr)), 1, uuid.New().String()}
+			newLocus := Locus{tr.Location().Name(), tr.Orient, float64(GetThreePrime(tr)), 1, locusIdentifier(tr, usedIDs, deterministicIDs)}
 			// Set locus id in description string:
 			tr.Desc = "\"" + newLocus.Id + "\"" + "\n" + tr.Desc
 			// Add to locus pool:
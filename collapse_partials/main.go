@@ -2,7 +2,6 @@ package main
 
 import (
 	"github.com/biogo/biogo/feat/gene"
-	"github.com/biogo/biogo/io/featio/gff"
 	"log"
 	"os"
 	"runtime"
@@ -30,28 +29,39 @@ func main() {
 		defer pprof.StopCPUProfile()
 	}
 
-	// Create new GFF writer on standard output:
-	gffWriter := gff.NewWriter(os.Stdout, 1000, true)
+	// Create new transcript writer on standard output:
+	trWriter := NewTranscriptWriter(os.Stdout, args.OutFormat)
 
 	// Request channel with input transcripts:
-	trsChan := ReadTranscripts(args.InputFiles)
+	errHandler := NewErrorHandler(args.ErrorPolicy, args.RejectsOut)
+	trsChan := ReadTranscripts(args.InputFiles, errHandler)
 
 	// Load transcripts into 3' loci:
-	locusPool := LoadLoci(trsChan, int(args.ThreeTolerance), args.MonoDiscard, args.UnorientDiscard)
+	locusPool := LoadLoci(trsChan, int(args.ThreeTolerance), args.MonoDiscard, args.UnorientDiscard, args.DeterministicIDs)
 
 	// Collapse partial transcripts into longer ones:
 	CollapsePartial(locusPool, int(args.FiveTolerance), int(args.InternalTolerance))
 
-	// Sort transcript by chromosome names and coordinates:
-	trsPool := SortTranscripts(FlattenLocusPool(locusPool))
+	var trsPool []*gene.CodingTranscript
+	switch args.OutFormat {
+	case FormatGTF, FormatGFF3:
+		// Keep the transcripts of a locus together under the same gene:
+		trsPool = SortTranscriptsByLocus(locusPool)
+	default:
+		// Sort transcript by chromosome names and coordinates:
+		trsPool = SortTranscripts(FlattenLocusPool(locusPool))
+	}
 
-	// Write out transcriopts in GFF2 format:
+	// Write out transcriopts in the requested format:
 	for _, tr := range trsPool {
-		gff := Transcript2GFF(tr)
-		writeGFFs(gffWriter, gff)
-
+		trWriter.Write(tr)
 	}
 
+	// Flush buffered output:
+	trWriter.Flush()
+
+	// Report malformed transcripts:
+	errHandler.Close()
 }
 
 // Store all transcipts in one slice.
@@ -1,9 +1,63 @@
 package main
 
 import (
+	"github.com/biogo/biogo/feat/gene"
 	"github.com/biogo/biogo/io/featio/gff"
+	"io"
 )
 
+// Supported output formats:
+const (
+	FormatGFF2  = "gff2"
+	FormatBED12 = "bed12"
+	FormatGTF   = "gtf"
+	FormatGFF3  = "gff3"
+)
+
+// Check whether the output format is supported.
+func ValidFormat(format string) bool {
+	switch format {
+	case FormatGFF2, FormatBED12, FormatGTF, FormatGFF3:
+		return true
+	}
+	return false
+}
+
+// Interface for writing out transcripts in various formats:
+type TranscriptWriter interface {
+	Write(tr *gene.CodingTranscript)
+	Flush()
+}
+
+// Create a new transcript writer for the specified format.
+func NewTranscriptWriter(out io.Writer, format string) TranscriptWriter {
+	switch format {
+	case FormatGFF2:
+		return &GFFTranscriptWriter{gff.NewWriter(out, 1000, true)}
+	case FormatBED12:
+		return NewBEDTranscriptWriter(out)
+	case FormatGTF, FormatGFF3:
+		return NewHierTranscriptWriter(out, format)
+	default:
+		L.Fatalf("Unsupported output format: %s\n", format)
+	}
+	return nil
+}
+
+// Transcript writer producing GFF2 output:
+type GFFTranscriptWriter struct {
+	gffWriter *gff.Writer
+}
+
+// Write transcript as GFF2 features.
+func (w *GFFTranscriptWriter) Write(tr *gene.CodingTranscript) {
+	writeGFFs(w.gffWriter, Transcript2GFF(tr))
+}
+
+// Nothing to flush, the GFF writer is not buffered.
+func (w *GFFTranscriptWriter) Flush() {
+}
+
 // Write a slice of GFF features to a writer.
 func writeGFFs(gffWriter *gff.Writer, trFeatures []gff.Feature) {
 	for _, feat := range trFeatures {
@@ -13,3 +67,11 @@ func writeGFFs(gffWriter *gff.Writer, trFeatures []gff.Feature) {
 		}
 	}
 }
+
+// Get gene ID, transcript ID and score of a transcript. The transcripts are
+// grouped into genes by the locus ID and the cluster size serves as score.
+func transcriptInfo(tr *gene.CodingTranscript) (string, string, *float64) {
+	locusID, clSize := parseDesc(tr.Desc)
+	score := float64(clSize)
+	return unquote(locusID), unquote(tr.ID), &score
+}
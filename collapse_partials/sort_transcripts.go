@@ -23,20 +23,59 @@ func (s byCoord) Swap(i, j int) {
 }
 
 func (s byCoord) Less(i, j int) bool {
-	if s[i].Location().Name() != s[j].Location().Name() {
-		if strings.Compare(s[i].Location().Name(), s[j].Location().Name()) == -1 {
+	if coordLess(s[i], s[j]) {
+		return true
+	}
+	if coordLess(s[j], s[i]) {
+		return false
+	}
+	// Break ties by transcript ID:
+	return s[i].ID < s[j].ID
+}
+
+// Compare transcripts by chromosome name, start and length.
+func coordLess(a, b *gene.CodingTranscript) bool {
+	if a.Location().Name() != b.Location().Name() {
+		if strings.Compare(a.Location().Name(), b.Location().Name()) == -1 {
 			return true
 		}
 	} else {
-		si := s[i].Location().Start() + s[i].Start()
-		sj := s[j].Location().Start() + s[j].Start()
-		if si != sj {
-			return si < sj
+		sa := a.Location().Start() + a.Start()
+		sb := b.Location().Start() + b.Start()
+		if sa != sb {
+			return sa < sb
 		} else {
-			li := s[i].Len()
-			lj := s[j].Len()
-			return li < lj
+			la := a.Len()
+			lb := b.Len()
+			return la < lb
 		}
 	}
 	return false
 }
+
+// Sort transcripts keeping the transcripts of each locus together. The loci
+// are ordered by the chromosome and coordinates of their first transcript.
+func SortTranscriptsByLocus(locusPool LocusPool) []*gene.CodingTranscript {
+	loci := make([][]*gene.CodingTranscript, 0, len(locusPool))
+	for _, trs := range locusPool {
+		loci = append(loci, SortTranscripts(trs))
+	}
+
+	sort.Slice(loci, func(i, j int) bool {
+		a, b := loci[i][0], loci[j][0]
+		if coordLess(a, b) {
+			return true
+		}
+		if coordLess(b, a) {
+			return false
+		}
+		// Break ties by locus ID:
+		return a.Desc < b.Desc
+	})
+
+	trsPool := make([]*gene.CodingTranscript, 0, 10000)
+	for _, trs := range loci {
+		trsPool = append(trsPool, trs...)
+	}
+	return trsPool
+}
@@ -44,12 +44,12 @@ func Feat2NewCodingTranscript(feature *gff.Feature) *gene.CodingTranscript {
 }
 
 // Convert GFF feature to a gene.Exon object
-func Feat2NewExon(feature *gff.Feature, tr *gene.CodingTranscript) gene.Exon {
+func Feat2NewExon(feature *gff.Feature, tr *gene.CodingTranscript) (gene.Exon, *RecordError) {
 
 	exonTrId := feature.FeatAttributes.Get("transcript_id")
 	// Check for transcript/exon mismatch:
 	if exonTrId != tr.Name() {
-		L.Fatalf("Exon/Transcript mismatch! Exon transcript id: %s Transcript id: %s\n", exonTrId, tr.Name())
+		return gene.Exon{}, NewRecordError(ErrExonMismatch, "Exon/Transcript mismatch! Exon transcript id: %s Transcript id: %s", exonTrId, tr.Name())
 	}
 	exonId := feature.FeatAttributes.Get("exon_id")
 
@@ -60,7 +60,7 @@ func Feat2NewExon(feature *gff.Feature, tr *gene.CodingTranscript) gene.Exon {
 		Desc:       exonId,
 	}
 
-	return exon
+	return exon, nil
 }
 
 // Convert a gene.CodingTranscript object into a slice of gff.Feature objects.
@@ -14,3 +14,11 @@ func MaxTwoInts(a, b int) int {
 	}
 	return b
 }
+
+// Remove surrounding double quotes from a GFF attribute value.
+func unquote(s string) string {
+	if len(s) >= 2 && s[0] == '"' && s[len(s)-1] == '"' {
+		return s[1 : len(s)-1]
+	}
+	return s
+}
@@ -4,6 +4,7 @@ import (
 	"flag"
 	"fmt"
 	"os"
+	"strings"
 )
 
 // Strand inference behaviour:
@@ -11,6 +12,7 @@ const (
 	StrandTag     = 0 // Use strand tag (XS or ts for minimap2).
 	StrandRead    = 1 // Use the strand of the reads.
 	StrandTagRead = 2 // Use tag or read orientation if unavailable.
+	StrandPrimer  = 3 // Use tag or cDNA primers and poly(A) in the soft clips if unavailable.
 )
 
 var Version, Build string
@@ -20,9 +22,42 @@ type CmdArgs struct {
 	MinimapInput    bool
 	ForceStrand     bool
 	TagReadStrand   bool
+	PrimerStrand    bool
+	SSP             string
+	VNP             string
 	StrandBehaviour int
 	InputFiles      []string
 	MaxProcs        int64
+	Regions         string
+	RegionsBed      string
+	OutFormat       string
+	JunctionsOut    string
+	JunctionsBed    bool
+	RefGenome       string
+	MotifStrand     bool
+	KnownJunctions  string
+	CorrectDist     int64
+	MinMapQ         int64
+	PrimaryOnly     bool
+	MinAlnFrac      float64
+	MaxErrorRate    float64
+	MinIntron       int64
+	DelIntron       int64
+	MinPolyA        int64
+	Metrics         bool
+	Barcodes        bool
+	DedupUMI        bool
+	Chimeric        bool
+	FusionsOut      string
+	SourceLabels    string
+	MergeInputs     bool
+	CramRef         string
+	ErrorPolicy     string
+	RejectsOut      string
+	ReportOut       string
+	SampleTag       string
+	SplitPrefix     string
+	UnmappedOut     string
 }
 
 // Parse command line arguments using the flag package.
@@ -33,7 +68,40 @@ func (a *CmdArgs) Parse() {
 	flag.BoolVar(&a.MinimapInput, "M", false, "Input is from minimap2.")
 	flag.BoolVar(&a.ForceStrand, "s", false, "Use read strand (from BAM flag) as feature orientation.")
 	flag.BoolVar(&a.TagReadStrand, "g", false, "Use strand tag as feature orientation then read strand if not available.")
+	flag.BoolVar(&a.PrimerStrand, "p", false, "Use strand tag as feature orientation then cDNA primers or poly(A)/poly(T) in the soft clips if not available.")
+	flag.StringVar(&a.SSP, "ssp", DefaultSSP, "Strand switching primer sequence used by -p.")
+	flag.StringVar(&a.VNP, "vnp", DefaultVNP, "VN primer sequence used by -p.")
 	flag.Int64Var(&a.MaxProcs, "t", 4, "Number of cores to use.")
+	flag.StringVar(&a.Regions, "r", "", "Only convert reads overlapping these regions (chr:start-end, comma separated).")
+	flag.StringVar(&a.RegionsBed, "b", "", "Only convert reads overlapping the regions in this BED file.")
+	flag.StringVar(&a.OutFormat, "F", FormatGFF2, "Output format (gff2, gtf, gff3 or bed12).")
+	flag.StringVar(&a.JunctionsOut, "j", "", "Write splice junctions to this file (STAR SJ.out.tab format).")
+	flag.BoolVar(&a.JunctionsBed, "J", false, "Write splice junctions in BED format (suitable for minimap2 --junc-bed).")
+	flag.StringVar(&a.RefGenome, "G", "", "Indexed reference genome FASTA used for annotating splice site motifs.")
+	flag.BoolVar(&a.MotifStrand, "I", false, "Infer orientation from splice site motifs if the strand tag is missing (requires -G).")
+	flag.StringVar(&a.KnownJunctions, "C", "", "Correct splice junctions using the introns from this annotation (GTF/GFF) or junctions (BED, SJ.out.tab) file.")
+	flag.Int64Var(&a.CorrectDist, "w", 10, "Maximum distance of splice junction correction.")
+	flag.Int64Var(&a.MinMapQ, "q", 0, "Minimum mapping quality.")
+	flag.BoolVar(&a.PrimaryOnly, "P", false, "Discard secondary and supplementary alignments.")
+	flag.Float64Var(&a.MinAlnFrac, "f", 0.0, "Minimum fraction of read bases aligned.")
+	flag.Float64Var(&a.MaxErrorRate, "e", -1.0, "Maximum alignment error rate (NM per alignment column, negative to disable).")
+	flag.Int64Var(&a.MinIntron, "i", 0, "Minimum intron length, shorter N operations are treated as deletions.")
+	flag.Int64Var(&a.DelIntron, "D", 0, "Treat deletions at least this long as introns (0 to disable).")
+	flag.Int64Var(&a.MinPolyA, "a", 0, "Minimum length of poly(A) tail in the soft clipped 3' end supporting a full length read (0 to disable detection).")
+	flag.BoolVar(&a.Metrics, "m", false, "Attach alignment metrics (MAPQ, identity, soft clips, read length, read group) as attributes.")
+	flag.BoolVar(&a.Barcodes, "c", false, "Attach cell barcode (CB tag) and UMI (UB tag) as attributes.")
+	flag.BoolVar(&a.DedupUMI, "u", false, "Discard reads sharing cell barcode, UMI and transcript structure with a previous read.")
+	flag.BoolVar(&a.Chimeric, "S", false, "Flag chimeric reads having supplementary alignments (SA tag) with attributes.")
+	flag.StringVar(&a.FusionsOut, "k", "", "Write breakpoints of chimeric reads (fusion candidates) to this file.")
+	flag.StringVar(&a.SourceLabels, "l", "", "Comma separated source labels of the input files (default: file names without extension).")
+	flag.BoolVar(&a.MergeInputs, "merge", false, "Merge coordinate sorted input files into a single sorted output instead of converting them one after another.")
+	flag.StringVar(&a.CramRef, "R", "", "Reference FASTA for decoding CRAM input, which requires samtools in the PATH (default: the genome set by -G).")
+	flag.StringVar(&a.ErrorPolicy, "E", PolicyStrict, "Policy for malformed records (strict, skip or warn).")
+	flag.StringVar(&a.RejectsOut, "X", "", "Write skipped malformed records to this file.")
+	flag.StringVar(&a.ReportOut, "O", "", "Write conversion summary report to this file (JSON if ending in .json, TSV otherwise).")
+	flag.StringVar(&a.SampleTag, "T", "", "Attach the value of this SAM tag (e.g. RG) as sample attribute.")
+	flag.StringVar(&a.SplitPrefix, "o", "", "Write the transcripts of each sample into a separate file with this prefix (requires -T).")
+	flag.StringVar(&a.UnmappedOut, "U", "", "Write unmapped, filtered, duplicate and skipped malformed reads to this file (FASTQ if ending in .fq or .fastq, read names otherwise).")
 	flag.BoolVar(&help, "h", false, "Print out help message.")
 	flag.BoolVar(&version, "V", false, "Print out version.")
 
@@ -53,8 +121,8 @@ func (a *CmdArgs) Parse() {
 	a.InputFiles = flag.Args()
 
 	//Check parameters:
-	if a.ForceStrand && a.TagReadStrand {
-		L.Fatalf("The -s and -g flags are mutually exclusive!\n")
+	if (a.ForceStrand && a.TagReadStrand) || (a.ForceStrand && a.PrimerStrand) || (a.TagReadStrand && a.PrimerStrand) {
+		L.Fatalf("The -s, -g and -p flags are mutually exclusive!\n")
 	}
 	if a.ForceStrand {
 		a.StrandBehaviour = StrandRead
@@ -62,4 +130,31 @@ func (a *CmdArgs) Parse() {
 	if a.TagReadStrand {
 		a.StrandBehaviour = StrandTagRead
 	}
+	if a.PrimerStrand {
+		a.StrandBehaviour = StrandPrimer
+	}
+	if !ValidFormat(a.OutFormat) {
+		L.Fatalf("Unsupported output format: %s\n", a.OutFormat)
+	}
+	if (a.OutFormat == FormatGTF || a.OutFormat == FormatGFF3) && !a.PrimaryOnly {
+		L.Printf("Warning: reads with multiple alignments produce duplicate gene and transcript IDs in %s output, use -P for valid output!\n", a.OutFormat)
+	}
+	if !ValidPolicy(a.ErrorPolicy) {
+		L.Fatalf("Unsupported error policy: %s\n", a.ErrorPolicy)
+	}
+	if a.MotifStrand && a.RefGenome == "" {
+		L.Fatalf("The -I flag requires a reference genome (-G)!\n")
+	}
+	if a.SplitPrefix != "" && a.SampleTag == "" {
+		L.Fatalf("The -o flag requires a sample tag (-T)!\n")
+	}
+	if a.JunctionsBed && a.JunctionsOut == "" {
+		L.Fatalf("The -J flag requires a junctions output file (-j)!\n")
+	}
+	if a.SourceLabels != "" && len(strings.Split(a.SourceLabels, ",")) != len(a.InputFiles) {
+		L.Fatalf("The number of source labels must match the number of input files!\n")
+	}
+	if (a.Regions != "" || a.RegionsBed != "") && len(a.InputFiles) == 0 {
+		L.Fatalf("Region restricted conversion requires indexed BAM files as input!\n")
+	}
 }
@@ -3,36 +3,286 @@ package main
 import (
 	"fmt"
 	"io"
+	"strconv"
 
 	"github.com/biogo/biogo/feat"
 	"github.com/biogo/biogo/feat/gene"
 	"github.com/biogo/biogo/feat/genome"
 	"github.com/biogo/biogo/io/featio/gff"
 	"github.com/biogo/biogo/seq"
-	"github.com/biogo/hts/bam"
 	"github.com/biogo/hts/sam"
 )
 
-// Turn a BAM file containing sliced alignments into GFF2 format annotation.
-func SplicedBam2GFF(inReader *bam.Reader, out io.Writer, nrProcBam int, minimapInput bool, strandBehaviour int) {
+// Struct holding the conversion settings and optional side outputs:
+type ConvOpts struct {
+	MinimapInput    bool
+	StrandBehaviour int
+	Primers         *StrandPrimers  // Primers used for strand inference by StrandPrimer.
+	Junctions       JunctionTable   // Collect splice junctions if not nil.
+	Genome          *RefGenome      // Annotate splice site motifs if not nil.
+	MotifStrand     bool            // Infer strand from splice site motifs if the strand tag is missing.
+	KnownJunctions  JunctionSet     // Correct splice junctions to known junctions if not nil.
+	CorrectDist     int             // Maximum distance of splice junction correction.
+	MinIntron       int             // Shorter N operations are treated as deletions.
+	DelIntron       int             // Deletions at least this long are treated as introns if positive.
+	MinPolyA        int             // Minimum poly(A) length supporting a 3' end, no detection if zero.
+	Metrics         bool            // Attach per-read alignment metrics as attributes.
+	Barcodes        bool            // Attach cell barcode and UMI as attributes.
+	SampleTag       string          // Attach the value of this tag as sample attribute if not empty.
+	Molecules       map[string]bool // Deduplicate reads by barcode, UMI and structure if not nil.
+	Chimeric        bool            // Flag reads having supplementary alignments (SA tag) with attributes.
+	Fusions         *FusionReport   // Report breakpoints of chimeric reads if not nil.
+	Filter          *FilterOpts     // Alignment filtering thresholds.
+	Discarded       DiscardCounts   // Number of discarded records by reason.
+	Errors          *ErrorHandler   // Handler of malformed records.
+	Stats           *ConvStats      // Collect conversion statistics if not nil.
+	Unmapped        *UnmappedWriter // Write unmapped and filtered reads if not nil.
+}
+
+// Number of records converted together by a worker:
+const convBatchSize = 1000
+
+// Struct to hold the conversion result of a record:
+type convResult struct {
+	record     *sam.Record
+	transcript *gene.CodingTranscript
+	attrs      gff.Attributes
+	strandSrc  string       // Source of the transcript orientation.
+	discard    string       // Reason for discarding the record, empty if kept.
+	err        *RecordError // Error raised by a malformed record.
+}
 
-	gffWriter := gff.NewWriter(out, 1000, true)
+// Struct to hold a batch of records and their conversion results:
+type recordBatch struct {
+	records []*sam.Record
+	sources []string // Sources of the records if tracked by the reader.
+	results []convResult
+	done    chan struct{} // Closed when the conversion of the batch finished.
+}
+
+// Turn a BAM file containing sliced alignments into annotation written by the transcript writer.
+// Batches of records are converted in parallel, while the results are processed in input order.
+func SplicedBam2GFF(inReader RecordReader, trWriter TranscriptWriter, nrProc int, opts *ConvOpts) {
+	if nrProc < 1 {
+		nrProc = 1
+	}
 
-	// Ierate over BAM records:
-	for {
-		record, err := inReader.Read()
+	// Channel of batches to convert and channel of batches in input order:
+	workChan := make(chan *recordBatch, nrProc)
+	orderedChan := make(chan *recordBatch, 2*nrProc)
 
-		if err == io.EOF {
-			break
+	// Check whether the reader tracks the sources of the records:
+	srcReader, tracked := inReader.(SourceReader)
+
+	// Iterate over BAM records and batch them up:
+	go func() {
+		batch := &recordBatch{records: make([]*sam.Record, 0, convBatchSize), done: make(chan struct{})}
+		for {
+			record, err := inReader.Read()
+
+			if err == io.EOF {
+				break
+			} else if err != nil {
+				L.Fatalf("Failed to read BAM record: %s\n", err)
+			}
+
+			batch.records = append(batch.records, record)
+			if tracked {
+				batch.sources = append(batch.sources, srcReader.Source())
+			}
+			if len(batch.records) == convBatchSize {
+				orderedChan <- batch
+				workChan <- batch
+				batch = &recordBatch{records: make([]*sam.Record, 0, convBatchSize), done: make(chan struct{})}
+			}
 		}
+		// Send last batch:
+		orderedChan <- batch
+		workChan <- batch
+
+		close(orderedChan)
+		close(workChan)
+	}()
+
+	// Start conversion workers:
+	for i := 0; i < nrProc; i++ {
+		go func() {
+			for batch := range workChan {
+				batch.results = make([]convResult, len(batch.records))
+				for j, record := range batch.records {
+					batch.results[j] = convertOrDiscard(record, opts)
+					// Tag transcript with the source of the record:
+					if batch.sources != nil && batch.results[j].transcript != nil {
+						batch.results[j].attrs = append(batch.results[j].attrs, gff.Attribute{Tag: "source", Value: batch.sources[j]})
+					}
+				}
+				close(batch.done)
+			}
+		}()
+	}
 
-		// Turn mapped SAM records into GFF:
-		if record.Flags&sam.Unmapped == 0 {
-			SplicedSAM2GFF(record, gffWriter, minimapInput, strandBehaviour)
+	// Process conversion results in input order:
+	for batch := range orderedChan {
+		<-batch.done
+		for _, res := range batch.results {
+			processResult(res, trWriter, opts)
 		}
 	}
 }
 
+// Filter and convert a record.
+func convertOrDiscard(record *sam.Record, opts *ConvOpts) convResult {
+	// Discard unmapped and filtered records:
+	if reason := FilterRecord(record, opts.Filter); reason != "" {
+		return convResult{record: record, discard: reason}
+	}
+
+	// Turn SAM record into transcript:
+	transcript, attrs, strandSrc, err := ConvertRecord(record, opts)
+	if err != nil {
+		return convResult{record: record, err: err}
+	}
+	return convResult{record: record, transcript: transcript, attrs: attrs, strandSrc: strandSrc}
+}
+
+// Process a conversion result: update the side outputs and write out the transcript.
+// Not safe for concurrent use.
+func processResult(res convResult, trWriter TranscriptWriter, opts *ConvOpts) {
+	record, transcript := res.record, res.transcript
+	if opts.Stats != nil {
+		opts.Stats.AddRecord(record)
+	}
+
+	if res.discard != "" {
+		opts.Discarded[res.discard]++
+		if opts.Unmapped != nil {
+			opts.Unmapped.Write(record, res.discard)
+		}
+		return
+	}
+
+	// Handle malformed records:
+	if res.err != nil {
+		opts.Errors.Handle(res.err, recordLine(record))
+		if opts.Unmapped != nil {
+			opts.Unmapped.Write(record, res.err.Type)
+		}
+		return
+	}
+
+	// Discard reads from already seen molecules:
+	if opts.Molecules != nil {
+		if key, ok := MoleculeKey(record, transcript); ok {
+			if opts.Molecules[key] {
+				opts.Discarded[DiscardDuplicate]++
+				if opts.Unmapped != nil {
+					opts.Unmapped.Write(record, DiscardDuplicate)
+				}
+				return
+			}
+			opts.Molecules[key] = true
+		}
+	}
+
+	// Report breakpoints of chimeric reads once, from the primary alignment
+	// (the SA tag was already validated during conversion):
+	if opts.Fusions != nil && record.Flags&(sam.Secondary|sam.Supplementary) == 0 {
+		if pieces, _ := ChimericPieces(record); len(pieces) > 1 {
+			opts.Fusions.Write(record.Name, pieces)
+		}
+	}
+
+	// Register splice junctions:
+	if opts.Junctions != nil {
+		opts.Junctions.Add(record, transcript)
+	}
+	// Update conversion statistics:
+	if opts.Stats != nil {
+		opts.Stats.Add(transcript, res.strandSrc)
+	}
+	// Write out transcript:
+	trWriter.Write(transcript, res.attrs)
+}
+
+// Convert a mapped SAM record into a transcript, its extra attributes and the source of its orientation.
+// Safe for concurrent use, all side effects are left to the caller.
+func ConvertRecord(record *sam.Record, opts *ConvOpts) (*gene.CodingTranscript, gff.Attributes, string, *RecordError) {
+	transcript, err := SplicedSAM2Transcript(record, opts.MinimapInput, opts.StrandBehaviour, opts.MinIntron, opts.DelIntron)
+	if err != nil {
+		return nil, nil, "", err
+	}
+	var attrs gff.Attributes
+
+	// The strand tag was already validated during conversion:
+	trStrand, _ := getTrStrand(record, opts.MinimapInput)
+	strandSrc := StrandSourceTag
+	if opts.StrandBehaviour == StrandRead || (opts.StrandBehaviour == StrandTagRead && trStrand == feat.NotOriented) {
+		strandSrc = StrandSourceRead
+	}
+
+	// Orient reads missing the strand tag using primers and poly(A) in the soft clips:
+	if opts.StrandBehaviour == StrandPrimer && transcript.Orient == feat.NotOriented {
+		transcript.Orient = PrimerStrand(record, opts.Primers)
+		strandSrc = StrandSourcePrimer
+	}
+
+	// Snap splice junctions to the closest known junctions:
+	if opts.KnownJunctions != nil {
+		nrCorrected := CorrectJunctions(transcript, opts.KnownJunctions, opts.CorrectDist)
+		attrs = append(attrs, gff.Attribute{Tag: "corrected_junctions", Value: strconv.Itoa(nrCorrected)})
+	}
+
+	// Annotate splice site motifs:
+	if opts.Genome != nil {
+		motifs := TranscriptMotifs(transcript, opts.Genome)
+		// Infer orientation from the motifs if the strand tag is missing:
+		if opts.MotifStrand && opts.StrandBehaviour != StrandRead && trStrand == feat.NotOriented {
+			if strand := MotifStrand(motifs); strand != feat.NotOriented {
+				transcript.Orient = strand
+				strandSrc = StrandSourceMotif
+			}
+		}
+		attrs = append(attrs, MotifAttributes(transcript, motifs)...)
+	}
+
+	// Detect poly(A) tails in the soft clipped 3' ends:
+	if opts.MinPolyA > 0 {
+		attrs = append(attrs, PolyAAttributes(PolyALength(record, transcript.Orient), opts.MinPolyA)...)
+	}
+
+	// Attach alignment metrics:
+	if opts.Metrics {
+		attrs = append(attrs, MetricsAttributes(record)...)
+	}
+
+	// Flag chimeric reads, validating the SA tag for the fusion report too:
+	if opts.Chimeric || opts.Fusions != nil {
+		pieces, err := ChimericPieces(record)
+		if err != nil {
+			return nil, nil, "", err
+		}
+		if opts.Chimeric && pieces != nil {
+			attrs = append(attrs, ChimericAttributes(pieces)...)
+		}
+	}
+
+	// Attach cell barcode and UMI:
+	if opts.Barcodes {
+		attrs = append(attrs, BarcodeAttributes(record)...)
+	}
+
+	// Attach sample:
+	if opts.SampleTag != "" {
+		attrs = append(attrs, SampleAttributes(record, opts.SampleTag)...)
+	}
+
+	if transcript.Orient == feat.NotOriented {
+		strandSrc = StrandSourceNone
+	}
+
+	return transcript, attrs, strandSrc, nil
+}
+
 // Create a new gene.CodingTranscript object from SAM reference, position and orientation.
 func NewCodingTranscript(chrom *sam.Reference, id string, pos int, strand feat.Orientation) *gene.CodingTranscript {
 
@@ -59,7 +309,7 @@ func NewCodingTranscript(chrom *sam.Reference, id string, pos int, strand feat.O
 }
 
 // Get orientation from transcript strand tag (either XS, or ts for minimap2).
-func getTrStrand(rec *sam.Record, minimapInput bool) feat.Orientation {
+func getTrStrand(rec *sam.Record, minimapInput bool) (feat.Orientation, *RecordError) {
 	var aux sam.Aux
 	if minimapInput {
 		aux, _ = rec.Tag([]byte("ts"))
@@ -70,24 +320,28 @@ func getTrStrand(rec *sam.Record, minimapInput bool) feat.Orientation {
 	// We got the tag value:
 	if aux != nil {
 		// Convert tag value to string:
-		strand := string(aux.Value().(uint8))
+		value, ok := aux.Value().(uint8)
+		if !ok {
+			return feat.NotOriented, NewRecordError(ErrStrandTag, "Strand tag of unexpected type in record %s: %s", rec.Name, aux)
+		}
+		strand := string(value)
 		// Decide orientation:
 		switch strand {
 		case "+":
-			return feat.Forward
+			return feat.Forward, nil
 		case "-":
-			return feat.Reverse
+			return feat.Reverse, nil
 		case "?":
-			return feat.NotOriented
+			return feat.NotOriented, nil
 		default:
-			L.Fatalf("Unknown orientation string: %s\n", strand)
+			return feat.NotOriented, NewRecordError(ErrStrandTag, "Unknown orientation string in record %s: %s", rec.Name, strand)
 		}
 	} else {
 		//L.Printf("Missing strand tag in record: %s\n", rec.Name)
 	}
 
 	// Missing tag, feature not oriented:
-	return feat.NotOriented
+	return feat.NotOriented, nil
 }
 
 // Flip orientation:
@@ -122,6 +376,8 @@ func figureStrand(readStrand, trStrand feat.Orientation, minimapInput bool, stra
 			strand = feat.NotOriented // Strand tag takes precedence, feature is not oriented.
 		case StrandTagRead:
 			strand = readStrand // Fallback to read orientation.
+		case StrandPrimer:
+			strand = feat.NotOriented // Oriented later using the soft clips.
 		}
 		return strand
 	}
@@ -143,8 +399,21 @@ func figureStrand(readStrand, trStrand feat.Orientation, minimapInput bool, stra
 	return strand
 }
 
-// Convert SAM record into GFF2 records. Each read will be represented as a distinct transcript.
-func SplicedSAM2GFF(record *sam.Record, gffWriter *gff.Writer, minimapInput bool, strandBehaviour int) {
+// Decide whether a deletion or N operation should be treated as an intron. N operations
+// are introns if not shorter than minIntron, deletions if delIntron is positive and
+// they are not shorter than it.
+func isIntron(op sam.CigarOpType, length int, minIntron int, delIntron int) bool {
+	switch op {
+	case sam.CigarSkipped:
+		return length >= minIntron
+	case sam.CigarDeletion:
+		return delIntron > 0 && length >= delIntron
+	}
+	return false
+}
+
+// Convert SAM record into a transcript. Each read will be represented as a distinct transcript.
+func SplicedSAM2Transcript(record *sam.Record, minimapInput bool, strandBehaviour int, minIntron int, delIntron int) (*gene.CodingTranscript, *RecordError) {
 
 	//Get read strand:
 	var readStrand feat.Orientation = feat.Forward
@@ -153,7 +422,10 @@ func SplicedSAM2GFF(record *sam.Record, gffWriter *gff.Writer, minimapInput bool
 	}
 
 	// Get transcript strand:
-	trStrand := getTrStrand(record, minimapInput)
+	trStrand, recErr := getTrStrand(record, minimapInput)
+	if recErr != nil {
+		return nil, recErr
+	}
 
 	// Decide feature strand:
 	strand := figureStrand(readStrand, trStrand, minimapInput, strandBehaviour)
@@ -178,12 +450,18 @@ CIGAR_LOOP: // Iterate over CIGAR:
 		case sam.CigarSoftClipped, sam.CigarHardClipped, sam.CigarInsertion:
 			continue CIGAR_LOOP
 
-			// Match, mismatch or deletion - add to current exon length:
-		case sam.CigarMatch, sam.CigarEqual, sam.CigarMismatch, sam.CigarDeletion:
+			// Match or mismatch - add to current exon length:
+		case sam.CigarMatch, sam.CigarEqual, sam.CigarMismatch:
 			currBlockLen += length
 
-		// N operation:
-		case sam.CigarSkipped:
+		// Deletion or N operation:
+		case sam.CigarDeletion, sam.CigarSkipped:
+			// Short N operations and deletions are added to the current exon length:
+			if !isIntron(op, length, minIntron, delIntron) {
+				currBlockLen += length
+				continue CIGAR_LOOP
+			}
+
 			exonStart := currBlockStart              // Previous exon starting here.
 			exonEnd := currBlockStart + currBlockLen // Previous exon ends here.
 
@@ -197,11 +475,11 @@ CIGAR_LOOP: // Iterate over CIGAR:
 			}
 
 			currBlockLen = 0                  // Reset exon length counter.
-			currBlockStart = exonEnd + length // Next exon starts after the N operation.
+			currBlockStart = exonEnd + length // Next exon starts after the intron.
 			exonNr++
 
 		default:
-			L.Fatalf("Unsupported CIGAR operation %s\n in record %s\n", op, record.Name) // FIXME
+			return nil, NewRecordError(ErrCigar, "Unsupported CIGAR operation %s in record %s", op, record.Name)
 		}
 
 	}
@@ -218,23 +496,23 @@ CIGAR_LOOP: // Iterate over CIGAR:
 	// Add exons to the transcript:
 	err := transcript.SetExons(exons...)
 	if err != nil {
-		L.Fatalf("Could not set exons for %s: %s\n", transcript.ID, err)
+		return nil, NewRecordError(ErrExons, "Could not set exons for %s: %s", transcript.ID, err)
 	}
 
-	// Convert transcript into GFF2 features:
-	trFeatures := Transcript2GFF(transcript)
+	return transcript, nil
+}
 
-	// Write GFF features:
-	for _, feat := range trFeatures {
-		_, err := gffWriter.Write(&feat)
-		if err != nil {
-			L.Fatalf("Failed to write feature %s: %s", feat, err)
-		}
+// Format a record as a SAM line for the rejects file.
+func recordLine(record *sam.Record) string {
+	line, err := record.MarshalText()
+	if err != nil {
+		return record.Name
 	}
+	return string(line)
 }
 
-// Convert a gene.CodingTranscript object into a slice of GFF features.
-func Transcript2GFF(tr *gene.CodingTranscript) []gff.Feature {
+// Convert a gene.CodingTranscript object into a slice of GFF features. Extra attributes are attached to the mRNA feature.
+func Transcript2GFF(tr *gene.CodingTranscript, extraAttrs gff.Attributes) []gff.Feature {
 	res := make([]gff.Feature, 0, len(tr.Exons())+1)
 
 	trFeat := gff.Feature{
@@ -246,7 +524,7 @@ func Transcript2GFF(tr *gene.CodingTranscript) []gff.Feature {
 		FeatScore:      nil,
 		FeatStrand:     seq.Strand(tr.Orient),
 		FeatFrame:      gff.NoFrame,
-		FeatAttributes: gff.Attributes{gff.Attribute{Tag: "gene_id", Value: "\"" + tr.ID + "\""}, gff.Attribute{Tag: "transcript_id", Value: "\"" + tr.ID + "\";"}},
+		FeatAttributes: gff2Attributes(gff.Attributes{gff.Attribute{Tag: "gene_id", Value: "\"" + tr.ID + "\""}, gff.Attribute{Tag: "transcript_id", Value: "\"" + tr.ID + "\""}}, extraAttrs),
 	}
 
 	res = append(res, trFeat)
@@ -0,0 +1,44 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/biogo/biogo/feat/gene"
+	"github.com/biogo/biogo/io/featio/gff"
+	"github.com/biogo/hts/sam"
+)
+
+// Reason for discarding reads sharing barcode, UMI and structure:
+const DiscardDuplicate = "duplicate_umi"
+
+// Generate the cell barcode (CB) and UMI (UB) attributes of a record (if present).
+func BarcodeAttributes(record *sam.Record) gff.Attributes {
+	var attrs gff.Attributes
+	if cb, ok := auxString(record, "CB"); ok {
+		attrs = append(attrs, gff.Attribute{Tag: "cell_barcode", Value: cb})
+	}
+	if ub, ok := auxString(record, "UB"); ok {
+		attrs = append(attrs, gff.Attribute{Tag: "umi", Value: ub})
+	}
+	return attrs
+}
+
+// Get a key identifying the molecule of a read by its cell barcode, UMI and
+// transcript structure. Returns false if the barcode or the UMI is missing.
+func MoleculeKey(record *sam.Record, tr *gene.CodingTranscript) (string, bool) {
+	cb, ok := auxString(record, "CB")
+	if !ok {
+		return "", false
+	}
+	ub, ok := auxString(record, "UB")
+	if !ok {
+		return "", false
+	}
+
+	key := []string{cb, ub, tr.Location().Name(), strandString(tr.Orient)}
+	for _, exon := range tr.Exons() {
+		key = append(key, fmt.Sprintf("%d-%d", tr.Offset+exon.Start(), tr.Offset+exon.End()))
+	}
+	return strings.Join(key, ":"), true
+}
@@ -0,0 +1,170 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/biogo/biogo/feat"
+	"github.com/biogo/biogo/io/featio/gff"
+	"github.com/biogo/hts/sam"
+)
+
+// Struct to hold an alignment piece of a chimeric read (zero based half open
+// reference coordinates, query coordinates in the original read orientation):
+type AlnPiece struct {
+	Chrom  string
+	Start  int
+	End    int
+	Strand feat.Orientation
+	QStart int
+	QEnd   int
+	MapQ   int
+}
+
+// Calculate the query coordinates of an alignment piece from its CIGAR.
+func (p *AlnPiece) setQueryCoords(cigar sam.Cigar) {
+	var clipStart, clipEnd, aligned, refLen int
+	seenAligned := false
+	for _, op := range cigar {
+		length := op.Len()
+		switch op.Type() {
+		case sam.CigarSoftClipped, sam.CigarHardClipped:
+			if seenAligned {
+				clipEnd += length
+			} else {
+				clipStart += length
+			}
+		case sam.CigarMatch, sam.CigarEqual, sam.CigarMismatch:
+			aligned += length
+			refLen += length
+			seenAligned = true
+		case sam.CigarInsertion:
+			aligned += length
+			seenAligned = true
+		case sam.CigarDeletion, sam.CigarSkipped:
+			refLen += length
+			seenAligned = true
+		}
+	}
+
+	p.End = p.Start + refLen
+	p.QStart, p.QEnd = clipStart, clipStart+aligned
+	// Query coordinates are reversed for reverse strand alignments:
+	if p.Strand == feat.Reverse {
+		readLen := clipStart + aligned + clipEnd
+		p.QStart, p.QEnd = readLen-p.QEnd, readLen-p.QStart
+	}
+}
+
+// Get the pieces of a chimeric read from the record and its SA tag, sorted by
+// their position in the read. Returns nil if the record has no SA tag and an
+// error if the SA tag is malformed.
+func ChimericPieces(record *sam.Record) ([]AlnPiece, *RecordError) {
+	saTag, ok := auxString(record, "SA")
+	if !ok {
+		return nil, nil
+	}
+
+	pieces := make([]AlnPiece, 0, 2)
+
+	// Piece aligned by the record itself:
+	self := AlnPiece{
+		Chrom:  record.Ref.Name(),
+		Start:  record.Pos,
+		Strand: feat.Orientation(record.Strand()),
+		MapQ:   int(record.MapQ),
+	}
+	self.setQueryCoords(record.Cigar)
+	pieces = append(pieces, self)
+
+	// SA entries: rname,pos,strand,CIGAR,mapQ,NM;
+	for _, entry := range strings.Split(saTag, ";") {
+		if entry == "" {
+			continue
+		}
+		fields := strings.Split(entry, ",")
+		if len(fields) < 5 {
+			return nil, NewRecordError(ErrSATag, "Malformed SA tag in record %s: %s", record.Name, saTag)
+		}
+		pos, err1 := strconv.Atoi(fields[1])
+		mapq, err2 := strconv.Atoi(fields[4])
+		cigar, err3 := sam.ParseCigar([]byte(fields[3]))
+		if err1 != nil || err2 != nil || err3 != nil {
+			return nil, NewRecordError(ErrSATag, "Malformed SA tag in record %s: %s", record.Name, saTag)
+		}
+
+		piece := AlnPiece{
+			Chrom:  fields[0],
+			Start:  pos - 1,
+			Strand: parseStrand(fields[2]),
+			MapQ:   mapq,
+		}
+		piece.setQueryCoords(cigar)
+		pieces = append(pieces, piece)
+	}
+
+	sort.SliceStable(pieces, func(i, j int) bool { return pieces[i].QStart < pieces[j].QStart })
+	return pieces, nil
+}
+
+// Positions (zero based) of the 5' and 3' ends of a piece in the direction of the read.
+func (p AlnPiece) readEnds() (int, int) {
+	if p.Strand == feat.Reverse {
+		return p.End - 1, p.Start
+	}
+	return p.Start, p.End - 1
+}
+
+// Generate chimeric attributes: the loci of all pieces in read order.
+func ChimericAttributes(pieces []AlnPiece) gff.Attributes {
+	loci := make([]string, len(pieces))
+	for i, p := range pieces {
+		loci[i] = fmt.Sprintf("%s:%d-%d%s", p.Chrom, p.Start+1, p.End, strandString(p.Strand))
+	}
+	return gff.Attributes{
+		gff.Attribute{Tag: "chimeric", Value: "true"},
+		gff.Attribute{Tag: "chimeric_loci", Value: strings.Join(loci, ",")},
+	}
+}
+
+// Struct to hold the fusion candidate report:
+type FusionReport struct {
+	fh  *os.File
+	out *bufio.Writer
+}
+
+// Create fusion candidate report and write header.
+func NewFusionReport(reportFile string) *FusionReport {
+	fh, err := os.Create(reportFile)
+	if err != nil {
+		L.Fatalf("Could not create fusion report %s: %s\n", reportFile, err)
+	}
+	out := bufio.NewWriter(fh)
+	fmt.Fprintf(out, "Read\tChrom5\tBreak5\tStrand5\tChrom3\tBreak3\tStrand3\tReadGap\tMapQ5\tMapQ3\n")
+	return &FusionReport{fh, out}
+}
+
+// Write the breakpoints between consecutive pieces of a chimeric read. The
+// breakpoints are the last aligned base of the 5' piece and the first aligned
+// base of the 3' piece (one based), the read gap is negative if the pieces
+// overlap in the read.
+func (fr *FusionReport) Write(readName string, pieces []AlnPiece) {
+	for i := 0; i < len(pieces)-1; i++ {
+		a, b := pieces[i], pieces[i+1]
+		_, breakA := a.readEnds()
+		breakB, _ := b.readEnds()
+		fmt.Fprintf(fr.out, "%s\t%s\t%d\t%s\t%s\t%d\t%s\t%d\t%d\t%d\n", readName, a.Chrom, breakA+1, strandString(a.Strand), b.Chrom, breakB+1, strandString(b.Strand), b.QStart-a.QEnd, a.MapQ, b.MapQ)
+	}
+}
+
+// Flush and close the fusion report.
+func (fr *FusionReport) Close() {
+	if err := fr.out.Flush(); err != nil {
+		L.Fatalf("Failed to write fusion report: %s\n", err)
+	}
+	fr.fh.Close()
+}
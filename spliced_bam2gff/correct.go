@@ -0,0 +1,261 @@
+package main
+
+import (
+	"bufio"
+	"os"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/biogo/biogo/feat"
+	"github.com/biogo/biogo/feat/gene"
+)
+
+// Set of known splice junctions, sorted by start position on each chromosome:
+type JunctionSet map[string][]Junction
+
+// Regular expressions matching transcript identifiers in GTF/GFF2 and GFF3 exon lines:
+var (
+	gtfTranscriptRe  = regexp.MustCompile(`transcript_id "?([^";]+)"?`)
+	gff3TranscriptRe = regexp.MustCompile(`Parent=([^;]+)`)
+)
+
+// Load known junctions from an annotation (GTF/GFF) or junction (BED, SJ.out.tab) file.
+func LoadJunctionSet(juncFile string) JunctionSet {
+	fh, err := os.Open(juncFile)
+	if err != nil {
+		L.Fatalf("Could not open junctions file %s: %s\n", juncFile, err)
+	}
+	defer fh.Close()
+
+	var juncs []Junction
+	lower := strings.ToLower(juncFile)
+	switch {
+	case strings.HasSuffix(lower, ".gtf") || strings.HasSuffix(lower, ".gff") || strings.HasSuffix(lower, ".gff2") || strings.HasSuffix(lower, ".gff3"):
+		juncs = readAnnotationIntrons(bufio.NewScanner(fh), juncFile)
+	case strings.HasSuffix(lower, ".tab"):
+		juncs = readJunctionLines(bufio.NewScanner(fh), juncFile, true)
+	default:
+		juncs = readJunctionLines(bufio.NewScanner(fh), juncFile, false)
+	}
+
+	set := make(JunctionSet)
+	for _, junc := range juncs {
+		set[junc.Chrom] = append(set[junc.Chrom], junc)
+	}
+	for chrom, cjuncs := range set {
+		sort.Slice(cjuncs, func(i, j int) bool {
+			if cjuncs[i].Start != cjuncs[j].Start {
+				return cjuncs[i].Start < cjuncs[j].Start
+			}
+			return cjuncs[i].End < cjuncs[j].End
+		})
+		set[chrom] = cjuncs
+	}
+
+	return set
+}
+
+// Read junctions from BED or STAR SJ.out.tab lines.
+func readJunctionLines(scanner *bufio.Scanner, juncFile string, starFormat bool) []Junction {
+	juncs := make([]Junction, 0)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if line == "" || strings.HasPrefix(line, "#") || strings.HasPrefix(line, "track") || strings.HasPrefix(line, "browser") {
+			continue
+		}
+		fields := strings.Split(line, "\t")
+		if len(fields) < 3 {
+			L.Fatalf("Malformed junction line in %s: %s\n", juncFile, line)
+		}
+		start, err1 := strconv.Atoi(fields[1])
+		end, err2 := strconv.Atoi(fields[2])
+		if err1 != nil || err2 != nil {
+			L.Fatalf("Invalid junction coordinates in %s: %s\n", juncFile, line)
+		}
+
+		junc := Junction{RefID: -1, Chrom: fields[0], Start: start, End: end, Strand: feat.NotOriented}
+		if starFormat {
+			// One based intron start and numeric strand codes:
+			junc.Start--
+			if len(fields) > 3 {
+				switch fields[3] {
+				case "1":
+					junc.Strand = feat.Forward
+				case "2":
+					junc.Strand = feat.Reverse
+				}
+			}
+		} else if len(fields) > 5 {
+			junc.Strand = parseStrand(fields[5])
+		}
+		juncs = append(juncs, junc)
+	}
+	if err := scanner.Err(); err != nil {
+		L.Fatalf("Failed to read junctions file %s: %s\n", juncFile, err)
+	}
+	return juncs
+}
+
+// Struct to hold an annotated exon:
+type annotExon struct {
+	Chrom  string
+	Start  int
+	End    int
+	Strand feat.Orientation
+}
+
+// Read the introns of the transcripts from the exon lines of a GTF/GFF annotation.
+func readAnnotationIntrons(scanner *bufio.Scanner, annotFile string) []Junction {
+	trExons := make(map[string][]annotExon)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		fields := strings.Split(line, "\t")
+		if len(fields) < 9 || fields[2] != "exon" {
+			continue
+		}
+		start, err1 := strconv.Atoi(fields[3])
+		end, err2 := strconv.Atoi(fields[4])
+		if err1 != nil || err2 != nil {
+			L.Fatalf("Invalid exon coordinates in %s: %s\n", annotFile, line)
+		}
+
+		var trID string
+		if m := gtfTranscriptRe.FindStringSubmatch(fields[8]); m != nil {
+			trID = m[1]
+		} else if m := gff3TranscriptRe.FindStringSubmatch(fields[8]); m != nil {
+			trID = m[1]
+		} else {
+			L.Fatalf("Exon without transcript identifier in %s: %s\n", annotFile, line)
+		}
+
+		trExons[trID] = append(trExons[trID], annotExon{fields[0], start - 1, end, parseStrand(fields[6])})
+	}
+	if err := scanner.Err(); err != nil {
+		L.Fatalf("Failed to read annotation file %s: %s\n", annotFile, err)
+	}
+
+	// Introns lie between consecutive exons:
+	seen := make(map[Junction]bool)
+	juncs := make([]Junction, 0)
+	for _, exons := range trExons {
+		sort.Slice(exons, func(i, j int) bool { return exons[i].Start < exons[j].Start })
+		for i := 0; i < len(exons)-1; i++ {
+			junc := Junction{RefID: -1, Chrom: exons[i].Chrom, Start: exons[i].End, End: exons[i+1].Start, Strand: exons[i].Strand}
+			if junc.End <= junc.Start || seen[junc] {
+				continue
+			}
+			seen[junc] = true
+			juncs = append(juncs, junc)
+		}
+	}
+	return juncs
+}
+
+// Convert strand string into orientation.
+func parseStrand(s string) feat.Orientation {
+	switch s {
+	case "+":
+		return feat.Forward
+	case "-":
+		return feat.Reverse
+	}
+	return feat.NotOriented
+}
+
+// Check whether a junction is in the set, ignoring strand if either is not oriented.
+func (js JunctionSet) Contains(junc Junction) bool {
+	juncs := js[junc.Chrom]
+	i := sort.Search(len(juncs), func(i int) bool { return juncs[i].Start >= junc.Start })
+	for ; i < len(juncs) && juncs[i].Start == junc.Start; i++ {
+		if juncs[i].End == junc.End && strandsCompatible(juncs[i].Strand, junc.Strand) {
+			return true
+		}
+	}
+	return false
+}
+
+// Find the closest known junction having both boundaries within the tolerance.
+func (js JunctionSet) Closest(junc Junction, tolerance int) (Junction, bool) {
+	juncs := js[junc.Chrom]
+	var best Junction
+	bestDist := -1
+
+	i := sort.Search(len(juncs), func(i int) bool { return juncs[i].Start >= junc.Start-tolerance })
+	for ; i < len(juncs) && juncs[i].Start <= junc.Start+tolerance; i++ {
+		cand := juncs[i]
+		if !strandsCompatible(cand.Strand, junc.Strand) {
+			continue
+		}
+		deltaEnd := Abs(cand.End - junc.End)
+		if deltaEnd > tolerance {
+			continue
+		}
+		dist := Abs(cand.Start-junc.Start) + deltaEnd
+		if bestDist < 0 || dist < bestDist {
+			best, bestDist = cand, dist
+		}
+	}
+
+	return best, bestDist >= 0
+}
+
+// Orientations are compatible if they match or either of them is not oriented.
+func strandsCompatible(a, b feat.Orientation) bool {
+	return a == feat.NotOriented || b == feat.NotOriented || a == b
+}
+
+// Snap the introns of a transcript to the closest known junctions, returning the number of corrected junctions.
+func CorrectJunctions(tr *gene.CodingTranscript, known JunctionSet, tolerance int) int {
+	exons := tr.Exons()
+	if len(exons) < 2 {
+		return 0
+	}
+
+	// Absolute exon boundaries:
+	starts := make([]int, len(exons))
+	ends := make([]int, len(exons))
+	for i, exon := range exons {
+		starts[i] = tr.Offset + exon.Start()
+		ends[i] = tr.Offset + exon.End()
+	}
+
+	var corrected int
+	for i := 0; i < len(exons)-1; i++ {
+		junc := Junction{Chrom: tr.Location().Name(), Start: ends[i], End: starts[i+1], Strand: tr.Orient}
+		target, ok := known.Closest(junc, tolerance)
+		if !ok || (target.Start == junc.Start && target.End == junc.End) {
+			continue
+		}
+		// Do not let the flanking exons vanish:
+		if target.Start <= starts[i] || target.End >= ends[i+1] {
+			continue
+		}
+		ends[i], starts[i+1] = target.Start, target.End
+		corrected++
+	}
+
+	if corrected == 0 {
+		return 0
+	}
+
+	// Rebuild exons of the transcript:
+	newExons := make(gene.Exons, len(exons))
+	for i := range exons {
+		newExons[i] = gene.Exon{
+			Transcript: tr,
+			Offset:     starts[i] - tr.Offset,
+			Length:     ends[i] - starts[i],
+			Desc:       exons[i].Desc,
+		}
+	}
+	if err := tr.SetExons(newExons...); err != nil {
+		L.Fatalf("Could not set corrected exons for %s: %s\n", tr.ID, err)
+	}
+
+	return corrected
+}
@@ -0,0 +1,109 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"sort"
+)
+
+// Policies for handling malformed records:
+const (
+	PolicyStrict = "strict" // Abort on the first malformed record.
+	PolicySkip   = "skip"   // Skip and count malformed records.
+	PolicyWarn   = "warn"   // Skip and count malformed records, logging a warning for each.
+)
+
+// Types of malformed records:
+const (
+	ErrCigar     = "unsupported_cigar"
+	ErrStrandTag = "invalid_strand_tag"
+	ErrExons     = "invalid_exons"
+	ErrSATag     = "invalid_sa_tag"
+)
+
+// Struct to hold the error raised by a malformed record:
+type RecordError struct {
+	Type string
+	Msg  string
+}
+
+func (e *RecordError) Error() string {
+	return e.Msg
+}
+
+// Create a new record error of the specified type.
+func NewRecordError(errType string, format string, args ...interface{}) *RecordError {
+	return &RecordError{Type: errType, Msg: fmt.Sprintf(format, args...)}
+}
+
+// Check whether the error policy is supported.
+func ValidPolicy(policy string) bool {
+	switch policy {
+	case PolicyStrict, PolicySkip, PolicyWarn:
+		return true
+	}
+	return false
+}
+
+// Struct to handle malformed records according to the error policy:
+type ErrorHandler struct {
+	Policy  string
+	Counts  map[string]int // Number of malformed records by error type.
+	fh      *os.File
+	rejects *bufio.Writer
+}
+
+// Create a new error handler, writing the rejected records to a file if specified.
+func NewErrorHandler(policy string, rejectsFile string) *ErrorHandler {
+	h := &ErrorHandler{Policy: policy, Counts: make(map[string]int)}
+	if rejectsFile != "" {
+		fh, err := os.Create(rejectsFile)
+		if err != nil {
+			L.Fatalf("Could not create rejects file %s: %s\n", rejectsFile, err)
+		}
+		h.fh, h.rejects = fh, bufio.NewWriter(fh)
+	}
+	return h
+}
+
+// Handle a malformed record: abort under the strict policy, otherwise count
+// the error and write the record to the rejects file. Not safe for concurrent use.
+func (h *ErrorHandler) Handle(err *RecordError, record string) {
+	switch h.Policy {
+	case PolicyStrict:
+		L.Fatalf("%s\n", err)
+	case PolicyWarn:
+		L.Printf("Skipping malformed record: %s\n", err)
+	}
+	h.Counts[err.Type]++
+	if h.rejects != nil {
+		fmt.Fprintf(h.rejects, "%s\n", record)
+	}
+}
+
+// Close the rejects file and log the number of malformed records by error type.
+func (h *ErrorHandler) Close() {
+	if h.rejects != nil {
+		if err := h.rejects.Flush(); err != nil {
+			L.Fatalf("Failed to write rejects file: %s\n", err)
+		}
+		h.fh.Close()
+	}
+
+	if len(h.Counts) == 0 {
+		return
+	}
+	types := make([]string, 0, len(h.Counts))
+	var total int
+	for errType, count := range h.Counts {
+		types = append(types, errType)
+		total += count
+	}
+	sort.Strings(types)
+
+	L.Printf("Malformed records skipped: %d\n", total)
+	for _, errType := range types {
+		L.Printf("\t%s: %d\n", errType, h.Counts[errType])
+	}
+}
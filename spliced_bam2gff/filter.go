@@ -0,0 +1,127 @@
+package main
+
+import (
+	"sort"
+
+	"github.com/biogo/hts/sam"
+)
+
+// Reasons for discarding records:
+const (
+	DiscardUnmapped      = "unmapped"
+	DiscardSecondary     = "secondary"
+	DiscardSupplementary = "supplementary"
+	DiscardMapQ          = "low_mapq"
+	DiscardAlnFrac       = "low_aligned_fraction"
+	DiscardErrorRate     = "high_error_rate"
+)
+
+// Struct holding alignment filtering thresholds:
+type FilterOpts struct {
+	MinMapQ      int
+	PrimaryOnly  bool    // Discard secondary and supplementary alignments.
+	MinAlnFrac   float64 // Minimum fraction of read bases aligned.
+	MaxErrorRate float64 // Maximum NM derived error rate, not applied if negative.
+}
+
+// Map holding the number of discarded records by reason:
+type DiscardCounts map[string]int
+
+// Alignment statistics derived from the CIGAR string:
+type AlnStats struct {
+	AlnColumns    int // Matches, mismatches, insertions and deletions.
+	QueryAligned  int // Read bases in matches, mismatches and insertions.
+	ReadLen       int // Read length including the clipped bases.
+	SoftClipStart int // Soft clipped bases at the start of the alignment (on the reference strand).
+	SoftClipEnd   int // Soft clipped bases at the end of the alignment (on the reference strand).
+}
+
+// Calculate alignment statistics from the CIGAR of a record.
+func CalcAlnStats(record *sam.Record) AlnStats {
+	var st AlnStats
+	seenAligned := false
+	for _, cigar := range record.Cigar {
+		length := cigar.Len()
+		switch cigar.Type() {
+		case sam.CigarSoftClipped:
+			if seenAligned {
+				st.SoftClipEnd += length
+			} else {
+				st.SoftClipStart += length
+			}
+			st.ReadLen += length
+		case sam.CigarHardClipped:
+			st.ReadLen += length
+		case sam.CigarMatch, sam.CigarEqual, sam.CigarMismatch, sam.CigarInsertion:
+			st.AlnColumns += length
+			st.QueryAligned += length
+			st.ReadLen += length
+			seenAligned = true
+		case sam.CigarDeletion:
+			st.AlnColumns += length
+			seenAligned = true
+		}
+	}
+	return st
+}
+
+// Get the NM derived error rate of an alignment.
+func ErrorRate(record *sam.Record, st AlnStats) (float64, bool) {
+	aux, ok := record.Tag([]byte("NM"))
+	if !ok || st.AlnColumns == 0 {
+		return 0, false
+	}
+	nm, ok := auxInt(aux)
+	if !ok {
+		return 0, false
+	}
+	return float64(nm) / float64(st.AlnColumns), true
+}
+
+// Decide whether a record should be discarded, returning the reason or an empty string.
+func FilterRecord(record *sam.Record, filter *FilterOpts) string {
+	if record.Flags&sam.Unmapped != 0 {
+		return DiscardUnmapped
+	}
+	if filter.PrimaryOnly {
+		if record.Flags&sam.Secondary != 0 {
+			return DiscardSecondary
+		}
+		if record.Flags&sam.Supplementary != 0 {
+			return DiscardSupplementary
+		}
+	}
+	if int(record.MapQ) < filter.MinMapQ {
+		return DiscardMapQ
+	}
+
+	// Filters based on the CIGAR string:
+	if filter.MinAlnFrac > 0 || filter.MaxErrorRate >= 0 {
+		st := CalcAlnStats(record)
+		if filter.MinAlnFrac > 0 && st.ReadLen > 0 && float64(st.QueryAligned)/float64(st.ReadLen) < filter.MinAlnFrac {
+			return DiscardAlnFrac
+		}
+		// Records without NM tag are not filtered by error rate:
+		if errRate, ok := ErrorRate(record, st); ok && filter.MaxErrorRate >= 0 && errRate > filter.MaxErrorRate {
+			return DiscardErrorRate
+		}
+	}
+
+	return ""
+}
+
+// Log the number of discarded records by reason.
+func (dc DiscardCounts) Log() {
+	reasons := make([]string, 0, len(dc))
+	var total int
+	for reason, count := range dc {
+		reasons = append(reasons, reason)
+		total += count
+	}
+	sort.Strings(reasons)
+
+	L.Printf("Discarded records: %d\n", total)
+	for _, reason := range reasons {
+		L.Printf("\t%s: %d\n", reason, dc[reason])
+	}
+}
@@ -2,29 +2,169 @@ package main
 
 import (
 	"bufio"
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io"
 	"os"
+	"os/exec"
+	"strings"
 
 	"github.com/biogo/hts/bam"
+	"github.com/biogo/hts/sam"
 )
 
-func NewSTDINReader(nrProc int) *bam.Reader {
-	reader, err := bam.NewReader(bufio.NewReader(os.Stdin), nrProc)
+// Interface for record readers providing the SAM header:
+type HeaderReader interface {
+	RecordReader
+	Header() *sam.Header
+}
+
+// Magic numbers used for detecting the input format:
+var (
+	gzipMagic = []byte{0x1f, 0x8b}
+	bamMagic  = []byte("BAM\x01")
+	cramMagic = []byte("CRAM")
+)
+
+// Create new record reader from standard input.
+func NewSTDINReader(nrProc int, cramRef string) HeaderReader {
+	return newRecordReader("stdin", os.Stdin, "-", nrProc, cramRef)
+}
+
+// Create new record reader from a BAM, SAM (plain or gzipped) or CRAM file.
+func NewInputReader(inFile string, nrProc int, cramRef string) HeaderReader {
+	fh, err := os.Open(inFile)
 	if err != nil {
-		L.Fatalf("Could not creater BAM reader from stdin: %s\n", err)
+		L.Fatalf("Could not open input file %s: %s\n", inFile, err)
 	}
-	return reader
+	return newRecordReader(inFile, fh, inFile, nrProc, cramRef)
 }
 
-// Create new BAM reader from file.
-func NewBamReader(bamFile string, nrProc int) *bam.Reader {
-	fh, err := os.Open(bamFile)
+// Detect the input format from the first bytes and create the appropriate reader.
+// The path is passed to samtools when decoding CRAM input.
+func newRecordReader(name string, r io.Reader, path string, nrProc int, cramRef string) HeaderReader {
+	// Buffer large enough to hold a full BGZF block:
+	br := bufio.NewReaderSize(r, 1<<16)
+	magic, _ := br.Peek(4)
+
+	switch {
+	case bytes.HasPrefix(magic, cramMagic):
+		// Files are opened by samtools itself:
+		if c, ok := r.(io.Closer); ok && path != "-" {
+			c.Close()
+		}
+		return newCramReader(name, br, path, cramRef)
+	case bytes.HasPrefix(magic, gzipMagic):
+		if isBAM(br) {
+			reader, err := bam.NewReader(br, nrProc)
+			if err != nil {
+				L.Fatalf("Could not create BAM reader for %s: %s\n", name, err)
+			}
+			return reader
+		}
+		gzReader, err := gzip.NewReader(br)
+		if err != nil {
+			L.Fatalf("Could not create gzip reader for %s: %s\n", name, err)
+		}
+		return newSAMReader(name, gzReader)
+	}
+	return newSAMReader(name, br)
+}
+
+// Check whether gzip compressed input is BAM by decompressing the start of the first block.
+func isBAM(br *bufio.Reader) bool {
+	block, _ := br.Peek(br.Size())
+	gzReader, err := gzip.NewReader(bytes.NewReader(block))
 	if err != nil {
-		L.Fatalf("Could not open input file %s: %s\n", bamFile, err)
+		return false
+	}
+	magic := make([]byte, len(bamMagic))
+	if _, err := io.ReadFull(gzReader, magic); err != nil {
+		return false
 	}
+	return bytes.Equal(magic, bamMagic)
+}
 
-	reader, err := bam.NewReader(bufio.NewReader(fh), nrProc)
+// Create a new SAM reader.
+func newSAMReader(name string, r io.Reader) *sam.Reader {
+	reader, err := sam.NewReader(r)
 	if err != nil {
-		L.Fatalf("Could not create BAM reader for %s: %s\n", bamFile, err)
+		L.Fatalf("Could not create SAM reader for %s: %s\n", name, err)
 	}
 	return reader
 }
+
+// Struct to read CRAM input decoded by samtools:
+type CramReader struct {
+	*sam.Reader
+	name   string
+	cmd    *exec.Cmd
+	stderr *bytes.Buffer // Error messages of samtools.
+}
+
+// Create a new CRAM reader decoding the input using samtools and a reference FASTA.
+// CRAM is not decoded natively, so samtools must be in the PATH.
+func newCramReader(name string, r io.Reader, path string, cramRef string) *CramReader {
+	samtools, err := exec.LookPath("samtools")
+	if err != nil {
+		L.Fatalf("Decoding CRAM input %s requires samtools in the PATH: %s\n", name, err)
+	}
+	if cramRef == "" {
+		L.Fatalf("Decoding CRAM input %s requires a reference FASTA (-R or -G)!\n", name)
+	}
+
+	cmd := exec.Command(samtools, "view", "-h", "-T", cramRef, path)
+	if path == "-" {
+		cmd.Stdin = r
+	}
+	stderr := new(bytes.Buffer)
+	cmd.Stderr = stderr
+	out, err := cmd.StdoutPipe()
+	if err != nil {
+		L.Fatalf("Could not create pipe for decoding CRAM input %s: %s\n", name, err)
+	}
+	if err := cmd.Start(); err != nil {
+		L.Fatalf("Could not run samtools for decoding CRAM input %s: %s\n", name, err)
+	}
+
+	cr := &CramReader{name: name, cmd: cmd, stderr: stderr}
+	reader, err := sam.NewReader(bufio.NewReader(out))
+	if err != nil {
+		L.Fatalf("Could not create SAM reader for %s: %s\n", name, cr.abort(err))
+	}
+	cr.Reader = reader
+	return cr
+}
+
+// Wait for samtools to exit and build an error from its exit status and
+// messages, or return the specified error if samtools succeeded.
+func (r *CramReader) wait(err error) error {
+	if werr := r.cmd.Wait(); werr != nil {
+		return fmt.Errorf("samtools failed decoding CRAM input %s (%s): %s", r.name, werr, strings.TrimSpace(r.stderr.String()))
+	}
+	return err
+}
+
+// Stop samtools after a parsing error and add its messages to the error.
+func (r *CramReader) abort(err error) error {
+	r.cmd.Process.Kill()
+	r.cmd.Wait()
+	if msg := strings.TrimSpace(r.stderr.String()); msg != "" {
+		return fmt.Errorf("%s (samtools: %s)", err, msg)
+	}
+	return err
+}
+
+// Read the next record. At the end of the input the exit status of samtools
+// is checked and its failure returned as an error.
+func (r *CramReader) Read() (*sam.Record, error) {
+	record, err := r.Reader.Read()
+	switch {
+	case err == io.EOF:
+		return nil, r.wait(err)
+	case err != nil:
+		return nil, r.abort(err)
+	}
+	return record, nil
+}
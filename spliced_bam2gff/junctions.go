@@ -0,0 +1,147 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"sort"
+
+	"github.com/biogo/biogo/feat"
+	"github.com/biogo/biogo/feat/gene"
+	"github.com/biogo/hts/sam"
+)
+
+// Struct to hold a splice junction (intron, zero based half open):
+type Junction struct {
+	RefID  int
+	Chrom  string
+	Start  int
+	End    int
+	Strand feat.Orientation
+}
+
+// Struct to hold splice junction statistics:
+type JunctionStats struct {
+	Unique      int // Number of uniquely mapped reads supporting the junction.
+	Multi       int // Number of multi-mapped reads supporting the junction.
+	MaxOverhang int // Maximum spliced alignment overhang.
+}
+
+// Map holding statistics for each unique splice junction:
+type JunctionTable map[Junction]*JunctionStats
+
+// Register the introns of a transcript converted from a SAM record.
+func (jt JunctionTable) Add(record *sam.Record, tr *gene.CodingTranscript) {
+	exons := tr.Exons()
+	multi := isMultiMapped(record)
+
+	for i := 0; i < len(exons)-1; i++ {
+		junc := Junction{
+			RefID:  record.Ref.ID(),
+			Chrom:  tr.Location().Name(),
+			Start:  tr.Offset + exons[i].End(),
+			End:    tr.Offset + exons[i+1].Start(),
+			Strand: tr.Orient,
+		}
+
+		stats, ok := jt[junc]
+		if !ok {
+			stats = new(JunctionStats)
+			jt[junc] = stats
+		}
+
+		if multi {
+			stats.Multi++
+		} else {
+			stats.Unique++
+		}
+
+		// The overhang is the shorter of the flanking aligned blocks:
+		overhang := exons[i].Len()
+		if exons[i+1].Len() < overhang {
+			overhang = exons[i+1].Len()
+		}
+		if overhang > stats.MaxOverhang {
+			stats.MaxOverhang = overhang
+		}
+	}
+}
+
+// Decide whether a record is a multi-mapped read (secondary alignment, zero mapping quality or NH > 1).
+func isMultiMapped(record *sam.Record) bool {
+	if record.Flags&sam.Secondary != 0 || record.MapQ == 0 {
+		return true
+	}
+	if aux, ok := record.Tag([]byte("NH")); ok {
+		if nh, ok := auxInt(aux); ok && nh > 1 {
+			return true
+		}
+	}
+	return false
+}
+
+// Get junctions sorted by reference order, coordinates and strand.
+func (jt JunctionTable) Sorted() []Junction {
+	juncs := make([]Junction, 0, len(jt))
+	for junc := range jt {
+		juncs = append(juncs, junc)
+	}
+	sort.Slice(juncs, func(i, j int) bool {
+		a, b := juncs[i], juncs[j]
+		if a.RefID != b.RefID {
+			return a.RefID < b.RefID
+		}
+		if a.Start != b.Start {
+			return a.Start < b.Start
+		}
+		if a.End != b.End {
+			return a.End < b.End
+		}
+		return a.Strand < b.Strand
+	})
+	return juncs
+}
+
+// Write junctions to file in STAR SJ.out.tab or BED format. The motif column is only filled if a reference genome is given,
+// while the annotation column is only filled if a set of known junctions is given.
+func (jt JunctionTable) Write(juncFile string, bedFormat bool, genome *RefGenome, known JunctionSet) {
+	fh, err := os.Create(juncFile)
+	if err != nil {
+		L.Fatalf("Could not create junctions file %s: %s\n", juncFile, err)
+	}
+	out := bufio.NewWriter(fh)
+
+	for i, junc := range jt.Sorted() {
+		stats := jt[junc]
+		if bedFormat {
+			// BED6, suitable for minimap2 --junc-bed:
+			fmt.Fprintf(out, "%s\t%d\t%d\tjunc_%d\t%d\t%s\n", junc.Chrom, junc.Start, junc.End, i, stats.Unique+stats.Multi, strandString(junc.Strand))
+		} else {
+			var motifCode, annotated int
+			if genome != nil {
+				motifCode, _, _ = ClassifyMotif(genome.IntronMotif(junc.Chrom, junc.Start, junc.End))
+			}
+			if known != nil && known.Contains(junc) {
+				annotated = 1
+			}
+			// SJ.out.tab: one based intron coordinates, strand and motif codes, annotation flag, counts and overhang:
+			fmt.Fprintf(out, "%s\t%d\t%d\t%d\t%d\t%d\t%d\t%d\t%d\n", junc.Chrom, junc.Start+1, junc.End, starStrand(junc.Strand), motifCode, annotated, stats.Unique, stats.Multi, stats.MaxOverhang)
+		}
+	}
+
+	if err := out.Flush(); err != nil {
+		L.Fatalf("Failed to write junctions file %s: %s\n", juncFile, err)
+	}
+	fh.Close()
+}
+
+// Convert orientation into STAR strand code.
+func starStrand(orient feat.Orientation) int {
+	switch orient {
+	case feat.Forward:
+		return 1
+	case feat.Reverse:
+		return 2
+	}
+	return 0
+}
@@ -4,6 +4,9 @@ import (
 	"log"
 	"os"
 	"runtime"
+	"strings"
+
+	"github.com/biogo/hts/sam"
 )
 
 func main() {
@@ -16,15 +19,135 @@ func main() {
 	// Set the maximum number of OS threads to use:
 	runtime.GOMAXPROCS(int(args.MaxProcs))
 
-	// Iterate over input files:
+	// Load regions of interest:
+	regions := LoadRegions(args.Regions, args.RegionsBed)
+	regionMode := args.Regions != "" || args.RegionsBed != ""
+
+	// Create transcript writer on standard output or split by sample:
+	var trWriter TranscriptWriter
+	if args.SplitPrefix != "" {
+		trWriter = NewSplitTranscriptWriter(args.SplitPrefix, args.OutFormat)
+	} else {
+		trWriter = NewTranscriptWriter(os.Stdout, args.OutFormat)
+	}
+
+	// Set up conversion:
+	opts := &ConvOpts{
+		MinimapInput:    args.MinimapInput,
+		StrandBehaviour: args.StrandBehaviour,
+		Primers:         NewStrandPrimers(args.SSP, args.VNP),
+		MinIntron:       int(args.MinIntron),
+		DelIntron:       int(args.DelIntron),
+		MinPolyA:        int(args.MinPolyA),
+		Metrics:         args.Metrics,
+		Barcodes:        args.Barcodes,
+		SampleTag:       args.SampleTag,
+		Chimeric:        args.Chimeric,
+		Filter: &FilterOpts{
+			MinMapQ:      int(args.MinMapQ),
+			PrimaryOnly:  args.PrimaryOnly,
+			MinAlnFrac:   args.MinAlnFrac,
+			MaxErrorRate: args.MaxErrorRate,
+		},
+		Discarded: make(DiscardCounts),
+		Errors:    NewErrorHandler(args.ErrorPolicy, args.RejectsOut),
+	}
+	if args.JunctionsOut != "" {
+		opts.Junctions = make(JunctionTable)
+	}
+	if args.KnownJunctions != "" {
+		opts.KnownJunctions = LoadJunctionSet(args.KnownJunctions)
+		opts.CorrectDist = int(args.CorrectDist)
+	}
+	if args.FusionsOut != "" {
+		opts.Fusions = NewFusionReport(args.FusionsOut)
+	}
+	if args.ReportOut != "" {
+		opts.Stats = NewConvStats()
+	}
+	if args.UnmappedOut != "" {
+		opts.Unmapped = NewUnmappedWriter(args.UnmappedOut)
+	}
+	if args.DedupUMI {
+		opts.Molecules = make(map[string]bool)
+	}
+	if args.RefGenome != "" {
+		opts.Genome = LoadRefGenome(args.RefGenome)
+		opts.MotifStrand = args.MotifStrand
+	}
+
+	// Reference used for decoding CRAM input:
+	cramRef := args.CramRef
+	if cramRef == "" {
+		cramRef = args.RefGenome
+	}
+
+	// Open input files:
 	if len(args.InputFiles) != 0 {
-		for _, inBam := range args.InputFiles {
-			bamReader := NewBamReader(inBam, int(args.MaxProcs))
-			// Convert spliced BAM entries to GFF transcripts:
-			SplicedBam2GFF(bamReader, os.Stdout, int(args.MaxProcs), args.MinimapInput, args.StrandBehaviour)
+		readers := make([]RecordReader, len(args.InputFiles))
+		headers := make([]*sam.Header, len(args.InputFiles))
+		for i, inBam := range args.InputFiles {
+			if regionMode {
+				// Only iterate over records overlapping the regions:
+				reader := NewRegionReader(inBam, regions, int(args.MaxProcs))
+				readers[i], headers[i] = reader, reader.Header()
+			} else {
+				reader := NewInputReader(inBam, int(args.MaxProcs), cramRef)
+				readers[i], headers[i] = reader, reader.Header()
+			}
+		}
+
+		// Label records by source if there are several inputs or labels were specified:
+		var sources []string
+		if args.SourceLabels != "" {
+			sources = strings.Split(args.SourceLabels, ",")
+		} else if len(readers) > 1 {
+			sources = SourceLabels(args.InputFiles)
+		}
+
+		if args.MergeInputs && len(readers) > 1 {
+			// Merge sorted inputs into a single sorted stream:
+			bamReader := NewMergeReader(readers, headers, sources)
+			SplicedBam2GFF(bamReader, trWriter, int(args.MaxProcs), opts)
+		} else {
+			// Convert inputs one after another:
+			for i, bamReader := range readers {
+				if sources != nil {
+					bamReader = LabeledReader{bamReader, sources[i]}
+				}
+				// Convert spliced BAM entries to GFF transcripts:
+				SplicedBam2GFF(bamReader, trWriter, int(args.MaxProcs), opts)
+			}
 		}
 	} else {
-		bamReader := NewSTDINReader(int(args.MaxProcs))
-		SplicedBam2GFF(bamReader, os.Stdout, int(args.MaxProcs), args.MinimapInput, args.StrandBehaviour)
+		bamReader := NewSTDINReader(int(args.MaxProcs), cramRef)
+		SplicedBam2GFF(bamReader, trWriter, int(args.MaxProcs), opts)
+	}
+
+	// Flush buffered output:
+	trWriter.Flush()
+
+	// Report discarded and malformed records:
+	opts.Discarded.Log()
+	opts.Errors.Close()
+
+	// Write conversion summary report:
+	if opts.Stats != nil {
+		opts.Stats.Write(args.ReportOut, opts.Discarded, opts.Errors.Counts)
+	}
+
+	// Close unmapped reads file:
+	if opts.Unmapped != nil {
+		opts.Unmapped.Close()
+	}
+
+	// Close fusion candidate report:
+	if opts.Fusions != nil {
+		opts.Fusions.Close()
+	}
+
+	// Write out splice junctions:
+	if opts.Junctions != nil {
+		opts.Junctions.Write(args.JunctionsOut, args.JunctionsBed, opts.Genome, opts.KnownJunctions)
 	}
 }
@@ -0,0 +1,163 @@
+package main
+
+import (
+	"container/heap"
+	"io"
+	"path/filepath"
+	"strings"
+
+	"github.com/biogo/hts/sam"
+)
+
+// Interface for record readers tracking the source of the last record read:
+type SourceReader interface {
+	RecordReader
+	Source() string
+}
+
+// Struct to hold the next record of an input:
+type mergeItem struct {
+	record *sam.Record
+	input  int
+}
+
+// Heap of the next records of the inputs, ordered by coordinates and input
+// index. Unmapped records without reference come last:
+type mergeHeap []mergeItem
+
+func (h mergeHeap) Len() int { return len(h) }
+func (h mergeHeap) Less(i, j int) bool {
+	if c := compareRecords(h[i].record, h[j].record); c != 0 {
+		return c < 0
+	}
+	return h[i].input < h[j].input
+}
+func (h mergeHeap) Swap(i, j int)       { h[i], h[j] = h[j], h[i] }
+func (h *mergeHeap) Push(x interface{}) { *h = append(*h, x.(mergeItem)) }
+func (h *mergeHeap) Pop() interface{} {
+	old := *h
+	item := old[len(old)-1]
+	*h = old[:len(old)-1]
+	return item
+}
+
+// Compare the coordinates of two records.
+func compareRecords(a, b *sam.Record) int {
+	refA, refB := refRank(a), refRank(b)
+	switch {
+	case refA != refB:
+		return refA - refB
+	case a.Pos != b.Pos:
+		return a.Pos - b.Pos
+	}
+	return 0
+}
+
+// Get the rank of the reference of a record, unmapped records are ranked last.
+func refRank(record *sam.Record) int {
+	if record.Ref == nil || record.Ref.ID() < 0 {
+		return int(^uint(0) >> 1)
+	}
+	return record.Ref.ID()
+}
+
+// Struct to merge coordinate sorted inputs into a single sorted record stream:
+type MergeReader struct {
+	readers []RecordReader
+	sources []string
+	heap    mergeHeap
+	last    []*sam.Record // Last record read from each input.
+	source  string        // Source of the last record returned.
+}
+
+// Create a new merging reader from coordinate sorted inputs sharing the same
+// reference sequences, labeled by the specified sources.
+func NewMergeReader(readers []RecordReader, headers []*sam.Header, sources []string) *MergeReader {
+	// Reference IDs must mean the same across inputs:
+	for i := 1; i < len(headers); i++ {
+		if !sameRefs(headers[0], headers[i]) {
+			L.Fatalf("The reference sequences of input %s do not match the ones of %s!\n", sources[i], sources[0])
+		}
+	}
+
+	m := &MergeReader{
+		readers: readers,
+		sources: sources,
+		heap:    make(mergeHeap, 0, len(readers)),
+		last:    make([]*sam.Record, len(readers)),
+	}
+	for i := range readers {
+		m.pull(i)
+	}
+
+	return m
+}
+
+// Check whether two headers list the same reference sequences in the same order.
+func sameRefs(a, b *sam.Header) bool {
+	refsA, refsB := a.Refs(), b.Refs()
+	if len(refsA) != len(refsB) {
+		return false
+	}
+	for i := range refsA {
+		if refsA[i].Name() != refsB[i].Name() || refsA[i].Len() != refsB[i].Len() {
+			return false
+		}
+	}
+	return true
+}
+
+// Read the next record of an input and push it on the heap.
+func (m *MergeReader) pull(i int) {
+	record, err := m.readers[i].Read()
+	if err == io.EOF {
+		return
+	} else if err != nil {
+		L.Fatalf("Failed to read BAM record from %s: %s\n", m.sources[i], err)
+	}
+
+	if m.last[i] != nil && compareRecords(record, m.last[i]) < 0 {
+		L.Fatalf("Input %s is not coordinate sorted!\n", m.sources[i])
+	}
+	m.last[i] = record
+
+	heap.Push(&m.heap, mergeItem{record, i})
+}
+
+// Read the next record in coordinate order.
+func (m *MergeReader) Read() (*sam.Record, error) {
+	if len(m.heap) == 0 {
+		return nil, io.EOF
+	}
+	item := heap.Pop(&m.heap).(mergeItem)
+	m.source = m.sources[item.input]
+	m.pull(item.input)
+
+	return item.record, nil
+}
+
+// Get the source of the last record read.
+func (m *MergeReader) Source() string {
+	return m.source
+}
+
+// Struct to tag the records of a single input with its source:
+type LabeledReader struct {
+	RecordReader
+	source string
+}
+
+// Get the source of the records.
+func (r LabeledReader) Source() string {
+	return r.source
+}
+
+// Generate source labels from input file names by stripping the directory and extension.
+func SourceLabels(inputFiles []string) []string {
+	labels := make([]string, len(inputFiles))
+	for i, file := range inputFiles {
+		base := filepath.Base(file)
+		labels[i] = strings.TrimSuffix(base, filepath.Ext(base))
+	}
+	return labels
+}
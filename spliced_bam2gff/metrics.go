@@ -0,0 +1,31 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+
+	"github.com/biogo/biogo/io/featio/gff"
+	"github.com/biogo/hts/sam"
+)
+
+// Generate attributes holding per-read alignment metrics: mapping quality,
+// alignment identity (if the NM tag is present), soft clipped bases at both
+// ends of the alignment, read length and read group (if present).
+func MetricsAttributes(record *sam.Record) gff.Attributes {
+	st := CalcAlnStats(record)
+
+	attrs := gff.Attributes{gff.Attribute{Tag: "mapq", Value: strconv.Itoa(int(record.MapQ))}}
+	if errRate, ok := ErrorRate(record, st); ok {
+		attrs = append(attrs, gff.Attribute{Tag: "identity", Value: fmt.Sprintf("%.4f", 1.0-errRate)})
+	}
+	attrs = append(attrs,
+		gff.Attribute{Tag: "soft_clip_start", Value: strconv.Itoa(st.SoftClipStart)},
+		gff.Attribute{Tag: "soft_clip_end", Value: strconv.Itoa(st.SoftClipEnd)},
+		gff.Attribute{Tag: "read_length", Value: strconv.Itoa(st.ReadLen)},
+	)
+	if rg, ok := auxString(record, "RG"); ok {
+		attrs = append(attrs, gff.Attribute{Tag: "read_group", Value: rg})
+	}
+
+	return attrs
+}
@@ -0,0 +1,181 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"io/ioutil"
+	"os"
+	"strings"
+	"sync"
+
+	"github.com/biogo/biogo/feat"
+	"github.com/biogo/biogo/feat/gene"
+	"github.com/biogo/biogo/io/featio/gff"
+	"github.com/biogo/hts/fai"
+)
+
+// Splice site motif classes:
+const (
+	MotifCanonical     = "canonical"
+	MotifSemiCanonical = "semi-canonical"
+	MotifNonCanonical  = "non-canonical"
+)
+
+// Splice site motifs (as donor-acceptor on the forward strand) with their
+// STAR motif codes, orientation and class:
+var spliceMotifs = map[string]struct {
+	Code   int
+	Orient feat.Orientation
+	Class  string
+}{
+	"GT-AG": {1, feat.Forward, MotifCanonical},
+	"CT-AC": {2, feat.Reverse, MotifCanonical},
+	"GC-AG": {3, feat.Forward, MotifSemiCanonical},
+	"CT-GC": {4, feat.Reverse, MotifSemiCanonical},
+	"AT-AC": {5, feat.Forward, MotifSemiCanonical},
+	"GT-AT": {6, feat.Reverse, MotifSemiCanonical},
+}
+
+// Struct to hold an indexed reference genome:
+type RefGenome struct {
+	file *fai.File
+	mu   sync.Mutex // The underlying file is not safe for concurrent reads.
+}
+
+// Load reference genome from a FASTA file indexed by samtools faidx.
+func LoadRefGenome(fastaFile string) *RefGenome {
+	idxFh, err := os.Open(fastaFile + ".fai")
+	if err != nil {
+		L.Fatalf("Could not open FASTA index %s.fai: %s\n", fastaFile, err)
+	}
+	defer idxFh.Close()
+
+	idx, err := fai.ReadFrom(bufio.NewReader(idxFh))
+	if err != nil {
+		L.Fatalf("Could not read FASTA index %s.fai: %s\n", fastaFile, err)
+	}
+
+	fh, err := os.Open(fastaFile)
+	if err != nil {
+		L.Fatalf("Could not open reference FASTA %s: %s\n", fastaFile, err)
+	}
+
+	return &RefGenome{file: fai.NewFile(fh, idx)}
+}
+
+// Fetch an upper case reference segment (zero based, half open).
+func (g *RefGenome) Fetch(chrom string, start, end int) string {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	s, err := g.file.SeqRange(chrom, start, end)
+	if err != nil {
+		L.Fatalf("Could not fetch reference segment %s:%d-%d: %s\n", chrom, start+1, end, err)
+	}
+	b, err := ioutil.ReadAll(s)
+	if err != nil {
+		L.Fatalf("Could not read reference segment %s:%d-%d: %s\n", chrom, start+1, end, err)
+	}
+	return string(bytes.ToUpper(b))
+}
+
+// Get the splice site motif of an intron on the forward strand (donor-acceptor).
+func (g *RefGenome) IntronMotif(chrom string, start, end int) string {
+	if end-start < 4 {
+		return "NN-NN"
+	}
+	return g.Fetch(chrom, start, start+2) + "-" + g.Fetch(chrom, end-2, end)
+}
+
+// Classify a forward strand motif, returning the STAR motif code, implied orientation and class.
+func ClassifyMotif(motif string) (int, feat.Orientation, string) {
+	m, ok := spliceMotifs[motif]
+	if !ok {
+		return 0, feat.NotOriented, MotifNonCanonical
+	}
+	return m.Code, m.Orient, m.Class
+}
+
+// Reverse complement a forward strand motif.
+func revCompMotif(motif string) string {
+	comp := map[byte]byte{'A': 'T', 'T': 'A', 'G': 'C', 'C': 'G'}
+	res := make([]byte, len(motif))
+	for i := 0; i < len(motif); i++ {
+		b := motif[len(motif)-1-i]
+		if c, ok := comp[b]; ok {
+			b = c
+		} else if b != '-' {
+			b = 'N'
+		}
+		res[i] = b
+	}
+	return string(res)
+}
+
+// Get the forward strand motifs of the introns of a transcript.
+func TranscriptMotifs(tr *gene.CodingTranscript, genome *RefGenome) []string {
+	exons := tr.Exons()
+	motifs := make([]string, 0, len(exons))
+	for i := 0; i < len(exons)-1; i++ {
+		start := tr.Offset + exons[i].End()
+		end := tr.Offset + exons[i+1].Start()
+		motifs = append(motifs, genome.IntronMotif(tr.Location().Name(), start, end))
+	}
+	return motifs
+}
+
+// Infer transcript orientation from the majority of oriented intron motifs.
+func MotifStrand(motifs []string) feat.Orientation {
+	var votes int
+	for _, motif := range motifs {
+		_, orient, _ := ClassifyMotif(motif)
+		votes += int(orient)
+	}
+	switch {
+	case votes > 0:
+		return feat.Forward
+	case votes < 0:
+		return feat.Reverse
+	}
+	return feat.NotOriented
+}
+
+// Generate motif attributes of a transcript: the intron motifs in the
+// direction of transcription and the worst splice site class.
+func MotifAttributes(tr *gene.CodingTranscript, motifs []string) gff.Attributes {
+	if len(motifs) == 0 {
+		return nil
+	}
+
+	oriented := make([]string, len(motifs))
+	class := MotifCanonical
+	for i, motif := range motifs {
+		_, orient, motifClass := ClassifyMotif(motif)
+		// Motif does not match transcript orientation:
+		if tr.Orient != feat.NotOriented && orient != tr.Orient {
+			motifClass = MotifNonCanonical
+		}
+		switch {
+		case motifClass == MotifNonCanonical:
+			class = MotifNonCanonical
+		case motifClass == MotifSemiCanonical && class == MotifCanonical:
+			class = MotifSemiCanonical
+		}
+
+		if tr.Orient == feat.Reverse {
+			motif = revCompMotif(motif)
+		}
+		oriented[i] = motif
+	}
+
+	// Introns are listed in the direction of transcription:
+	if tr.Orient == feat.Reverse {
+		for i, j := 0, len(oriented)-1; i < j; i, j = i+1, j-1 {
+			oriented[i], oriented[j] = oriented[j], oriented[i]
+		}
+	}
+
+	return gff.Attributes{
+		gff.Attribute{Tag: "intron_motifs", Value: strings.Join(oriented, ",")},
+		gff.Attribute{Tag: "splice_class", Value: class},
+	}
+}
@@ -0,0 +1,93 @@
+package main
+
+import (
+	"io"
+	"strconv"
+
+	"github.com/biogo/biogo/feat/gene"
+	"github.com/biogo/biogo/io/featio/gff"
+)
+
+// Supported output formats:
+const (
+	FormatGFF2  = "gff2"
+	FormatBED12 = "bed12"
+	FormatGTF   = "gtf"
+	FormatGFF3  = "gff3"
+)
+
+// Check whether the output format is supported.
+func ValidFormat(format string) bool {
+	switch format {
+	case FormatGFF2, FormatBED12, FormatGTF, FormatGFF3:
+		return true
+	}
+	return false
+}
+
+// Interface for writing out transcripts (with optional extra attributes) in various formats:
+type TranscriptWriter interface {
+	Write(tr *gene.CodingTranscript, attrs gff.Attributes)
+	Flush()
+}
+
+// Create a new transcript writer for the specified format.
+func NewTranscriptWriter(out io.Writer, format string) TranscriptWriter {
+	switch format {
+	case FormatGFF2:
+		return &GFFTranscriptWriter{gff.NewWriter(out, 1000, true)}
+	case FormatBED12:
+		return NewBEDTranscriptWriter(out)
+	case FormatGTF, FormatGFF3:
+		return NewHierTranscriptWriter(out, format)
+	default:
+		L.Fatalf("Unsupported output format: %s\n", format)
+	}
+	return nil
+}
+
+// Transcript writer producing GFF2 output:
+type GFFTranscriptWriter struct {
+	gffWriter *gff.Writer
+}
+
+// Write transcript as GFF2 features.
+func (w *GFFTranscriptWriter) Write(tr *gene.CodingTranscript, attrs gff.Attributes) {
+	writeGFFs(w.gffWriter, Transcript2GFF(tr, attrs))
+}
+
+// Nothing to flush, the GFF writer is not buffered.
+func (w *GFFTranscriptWriter) Flush() {
+}
+
+// Write a slice of GFF features to a writer.
+func writeGFFs(gffWriter *gff.Writer, trFeatures []gff.Feature) {
+	for _, feat := range trFeatures {
+		_, err := gffWriter.Write(&feat)
+		if err != nil {
+			L.Fatalf("Failed to write feature %s: %s", feat, err)
+		}
+	}
+}
+
+// Append extra attributes to GFF2 attributes and terminate the attribute list.
+func gff2Attributes(attrs gff.Attributes, extraAttrs gff.Attributes) gff.Attributes {
+	for _, attr := range extraAttrs {
+		attrs = append(attrs, gff.Attribute{Tag: attr.Tag, Value: quoteValue(attr.Value)})
+	}
+	attrs[len(attrs)-1].Value += ";"
+	return attrs
+}
+
+// Quote non-numeric attribute values.
+func quoteValue(value string) string {
+	if _, err := strconv.ParseFloat(value, 64); err == nil {
+		return value
+	}
+	return "\"" + value + "\""
+}
+
+// Get gene ID, transcript ID and score of a transcript. Each read is treated as a distinct gene.
+func transcriptInfo(tr *gene.CodingTranscript) (string, string, *float64) {
+	return tr.ID, tr.ID, nil
+}
@@ -0,0 +1,101 @@
+package main
+
+import (
+	"strconv"
+
+	"github.com/biogo/biogo/feat"
+	"github.com/biogo/biogo/io/featio/gff"
+	"github.com/biogo/hts/sam"
+)
+
+// Get the soft clipped sequences at the start and end of an alignment (on the reference strand).
+func SoftClips(record *sam.Record) (string, string) {
+	seq := record.Seq.Expand()
+	if len(seq) == 0 || len(record.Cigar) == 0 {
+		return "", ""
+	}
+
+	var leftLen, rightLen int
+	// Soft clips might be preceded or followed by hard clips:
+	for _, cigar := range record.Cigar {
+		if cigar.Type() == sam.CigarHardClipped {
+			continue
+		}
+		if cigar.Type() == sam.CigarSoftClipped {
+			leftLen = cigar.Len()
+		}
+		break
+	}
+	for i := len(record.Cigar) - 1; i >= 0; i-- {
+		cigar := record.Cigar[i]
+		if cigar.Type() == sam.CigarHardClipped {
+			continue
+		}
+		if cigar.Type() == sam.CigarSoftClipped {
+			rightLen = cigar.Len()
+		}
+		break
+	}
+
+	if leftLen+rightLen > len(seq) {
+		return "", ""
+	}
+	return string(seq[:leftLen]), string(seq[len(seq)-rightLen:])
+}
+
+// Reverse a string.
+func reverseString(s string) string {
+	b := []byte(s)
+	for i, j := 0, len(b)-1; i < j; i, j = i+1, j-1 {
+		b[i], b[j] = b[j], b[i]
+	}
+	return string(b)
+}
+
+// Get the length of the homopolymer rich stretch at the start of a sequence
+// by finding its best scoring prefix, tolerating sporadic other bases.
+func homopolymerLength(seq string, base byte) int {
+	var score, best, bestLen int
+	for i := 0; i < len(seq); i++ {
+		if seq[i] == base {
+			score++
+		} else {
+			score -= 3
+		}
+		if score > best {
+			best, bestLen = score, i+1
+		}
+		// Stop when the stretch clearly ended:
+		if score < best-10 {
+			break
+		}
+	}
+	return bestLen
+}
+
+// Get the length of the poly(A) tail in the soft clips of a record given the
+// transcript orientation. Both ends are checked for unoriented transcripts.
+func PolyALength(record *sam.Record, orient feat.Orientation) int {
+	leftClip, rightClip := SoftClips(record)
+
+	// Poly(A) follows the alignment end on the forward strand:
+	polyA := homopolymerLength(rightClip, 'A')
+	// Poly(T) precedes the alignment start on the reverse strand:
+	polyT := homopolymerLength(reverseString(leftClip), 'T')
+
+	switch orient {
+	case feat.Forward:
+		return polyA
+	case feat.Reverse:
+		return polyT
+	}
+	return MaxInt(polyA, polyT)
+}
+
+// Generate poly(A) attributes: the tail length and whether the 3' end is supported by a tail.
+func PolyAAttributes(polyALen int, minPolyA int) gff.Attributes {
+	return gff.Attributes{
+		gff.Attribute{Tag: "polyA_length", Value: strconv.Itoa(polyALen)},
+		gff.Attribute{Tag: "full_3prime", Value: strconv.FormatBool(polyALen >= minPolyA)},
+	}
+}
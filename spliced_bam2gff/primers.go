@@ -0,0 +1,120 @@
+package main
+
+import (
+	"strings"
+
+	"github.com/biogo/biogo/feat"
+	"github.com/biogo/hts/sam"
+)
+
+// Default cDNA primer sequences (strand switching primer and VN primer):
+const (
+	DefaultSSP = "TTTCTGTTGGTGCTGATATTGCTGGG"
+	DefaultVNP = "ACTTGCCTGTCGCTCTATCTTC"
+)
+
+// Minimum length of poly(A)/poly(T) stretches used as strand evidence:
+const strandPolyALen = 10
+
+// Maximum fraction of edits tolerated when matching primers:
+const primerMaxErrors = 0.2
+
+// Struct to hold the primers used for strand inference:
+type StrandPrimers struct {
+	SSP string
+	VNP string
+}
+
+// Create primers for strand inference from sequences.
+func NewStrandPrimers(ssp, vnp string) *StrandPrimers {
+	return &StrandPrimers{strings.ToUpper(ssp), strings.ToUpper(vnp)}
+}
+
+// Reverse complement a DNA sequence.
+func revComp(s string) string {
+	comp := map[byte]byte{'A': 'T', 'T': 'A', 'G': 'C', 'C': 'G'}
+	res := make([]byte, len(s))
+	for i := 0; i < len(s); i++ {
+		b, ok := comp[s[len(s)-1-i]]
+		if !ok {
+			b = 'N'
+		}
+		res[i] = b
+	}
+	return string(res)
+}
+
+// Get the minimum edit distance of a primer aligned anywhere within a sequence
+// (semi-global alignment with free end gaps in the sequence).
+func primerDistance(seq, primer string) int {
+	prev := make([]int, len(seq)+1)
+	curr := make([]int, len(seq)+1)
+	for i := 1; i <= len(primer); i++ {
+		curr[0] = i
+		for j := 1; j <= len(seq); j++ {
+			cost := 1
+			if primer[i-1] == seq[j-1] {
+				cost = 0
+			}
+			curr[j] = MinInt(prev[j-1]+cost, MinInt(prev[j]+1, curr[j-1]+1))
+		}
+		prev, curr = curr, prev
+	}
+
+	best := len(primer)
+	for _, d := range prev {
+		if d < best {
+			best = d
+		}
+	}
+	return best
+}
+
+// Check whether a primer matches within a sequence.
+func primerMatches(seq, primer string) bool {
+	if primer == "" || len(seq) == 0 {
+		return false
+	}
+	return float64(primerDistance(seq, primer)) <= primerMaxErrors*float64(len(primer))
+}
+
+// Infer transcript orientation from the cDNA primers and poly(A)/poly(T)
+// stretches found in the soft clips of a record. Full length cDNA reads look like
+// SSP-transcript-poly(A)-revcomp(VNP) on the transcript strand, so the left and
+// right clips (on the reference strand) of forward transcripts carry the SSP and
+// poly(A) followed by the reverse complement of the VNP, while reverse transcripts
+// carry the VNP followed by poly(T) and the reverse complement of the SSP.
+func PrimerStrand(record *sam.Record, primers *StrandPrimers) feat.Orientation {
+	leftClip, rightClip := SoftClips(record)
+	leftClip, rightClip = strings.ToUpper(leftClip), strings.ToUpper(rightClip)
+
+	var votes int
+	// Evidence for forward transcripts:
+	if primerMatches(leftClip, primers.SSP) {
+		votes++
+	}
+	if primerMatches(rightClip, revComp(primers.VNP)) {
+		votes++
+	}
+	if homopolymerLength(rightClip, 'A') >= strandPolyALen {
+		votes++
+	}
+	// Evidence for reverse transcripts:
+	if primerMatches(leftClip, primers.VNP) {
+		votes--
+	}
+	if primerMatches(rightClip, revComp(primers.SSP)) {
+		votes--
+	}
+	if homopolymerLength(reverseString(leftClip), 'T') >= strandPolyALen {
+		votes--
+	}
+
+	switch {
+	case votes > 0:
+		return feat.Forward
+	case votes < 0:
+		return feat.Reverse
+	}
+	return feat.NotOriented
+}
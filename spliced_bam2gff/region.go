@@ -0,0 +1,315 @@
+package main
+
+import (
+	"bufio"
+	"io"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/biogo/hts/bam"
+	"github.com/biogo/hts/bgzf"
+	"github.com/biogo/hts/csi"
+	"github.com/biogo/hts/sam"
+)
+
+// Struct to hold a genomic region (zero based, half open):
+type Region struct {
+	Chrom string
+	Start int
+	End   int // Negative if the region extends to the end of the chromosome.
+}
+
+// Interface for the records sources used by the converter:
+type RecordReader interface {
+	Read() (*sam.Record, error)
+}
+
+// Load regions from a comma separated list of region strings and/or a BED file.
+func LoadRegions(regStr string, bedFile string) []Region {
+	regions := make([]Region, 0)
+	if regStr != "" {
+		for _, s := range strings.Split(regStr, ",") {
+			if strings.TrimSpace(s) == "" {
+				continue
+			}
+			regions = append(regions, ParseRegion(strings.TrimSpace(s)))
+		}
+	}
+	if bedFile != "" {
+		regions = append(regions, LoadBedRegions(bedFile)...)
+	}
+	return regions
+}
+
+// Parse a region string in chr, chr:start or chr:start-end format (one based, inclusive).
+func ParseRegion(s string) Region {
+	i := strings.LastIndex(s, ":")
+	// No coordinates, the whole chromosome is the region:
+	if i < 0 {
+		return Region{s, 0, -1}
+	}
+	chrom, coords := s[:i], s[i+1:]
+
+	var startStr, endStr string
+	if j := strings.Index(coords, "-"); j >= 0 {
+		startStr, endStr = coords[:j], coords[j+1:]
+	} else {
+		startStr = coords
+	}
+
+	start, err := strconv.Atoi(startStr)
+	if err != nil || start < 1 {
+		// Colon might be part of the chromosome name:
+		if endStr == "" {
+			return Region{s, 0, -1}
+		}
+		L.Fatalf("Invalid region start in %s\n", s)
+	}
+
+	end := -1
+	if endStr != "" {
+		end, err = strconv.Atoi(endStr)
+		if err != nil || end < start {
+			L.Fatalf("Invalid region end in %s\n", s)
+		}
+	}
+
+	return Region{chrom, start - 1, end}
+}
+
+// Load regions from the first three columns of a BED file.
+func LoadBedRegions(bedFile string) []Region {
+	fh, err := os.Open(bedFile)
+	if err != nil {
+		L.Fatalf("Could not open BED file %s: %s\n", bedFile, err)
+	}
+	defer fh.Close()
+
+	regions := make([]Region, 0)
+	scanner := bufio.NewScanner(fh)
+	for scanner.Scan() {
+		line := scanner.Text()
+		// Skip empty, comment and header lines:
+		if line == "" || strings.HasPrefix(line, "#") || strings.HasPrefix(line, "track") || strings.HasPrefix(line, "browser") {
+			continue
+		}
+		fields := strings.Fields(line)
+		if len(fields) < 3 {
+			L.Fatalf("Malformed BED line in %s: %s\n", bedFile, line)
+		}
+		start, err := strconv.Atoi(fields[1])
+		if err != nil {
+			L.Fatalf("Invalid BED start in %s: %s\n", bedFile, line)
+		}
+		end, err := strconv.Atoi(fields[2])
+		if err != nil || end < start {
+			L.Fatalf("Invalid BED end in %s: %s\n", bedFile, line)
+		}
+		regions = append(regions, Region{fields[0], start, end})
+	}
+	if err := scanner.Err(); err != nil {
+		L.Fatalf("Failed to read BED file %s: %s\n", bedFile, err)
+	}
+
+	return regions
+}
+
+// Sort regions by the order of chromosomes in the BAM header and merge the overlapping ones.
+func resolveRegions(regions []Region, refs map[string]*sam.Reference) []Region {
+	res := make([]Region, 0, len(regions))
+	for _, r := range regions {
+		ref, ok := refs[r.Chrom]
+		if !ok {
+			L.Printf("Chromosome %s not found in the BAM header, skipping region.\n", r.Chrom)
+			continue
+		}
+		if r.End < 0 || r.End > ref.Len() {
+			r.End = ref.Len()
+		}
+		res = append(res, r)
+	}
+
+	sort.Slice(res, func(i, j int) bool {
+		ri, rj := refs[res[i].Chrom].ID(), refs[res[j].Chrom].ID()
+		if ri != rj {
+			return ri < rj
+		}
+		return res[i].Start < res[j].Start
+	})
+
+	merged := make([]Region, 0, len(res))
+	for _, r := range res {
+		last := len(merged) - 1
+		if last >= 0 && merged[last].Chrom == r.Chrom && r.Start <= merged[last].End {
+			merged[last].End = MaxInt(merged[last].End, r.End)
+			continue
+		}
+		merged = append(merged, r)
+	}
+
+	return merged
+}
+
+// Interface wrapping .bai and .csi indices:
+type bamIndex interface {
+	Chunks(ref *sam.Reference, beg, end int) []bgzf.Chunk
+}
+
+// Wrapper for .bai indices:
+type baiIndex struct {
+	idx *bam.Index
+}
+
+func (i baiIndex) Chunks(ref *sam.Reference, beg, end int) []bgzf.Chunk {
+	chunks, err := i.idx.Chunks(ref, beg, end)
+	if err != nil {
+		// No reads indexed in region:
+		return nil
+	}
+	return chunks
+}
+
+// Wrapper for .csi indices:
+type csiIndex struct {
+	idx *csi.Index
+}
+
+func (i csiIndex) Chunks(ref *sam.Reference, beg, end int) []bgzf.Chunk {
+	return i.idx.Chunks(ref.ID(), beg, end)
+}
+
+// Find and load the .bai or .csi index of a BAM file.
+func LoadBamIndex(bamFile string) bamIndex {
+	candidates := []string{bamFile + ".bai", strings.TrimSuffix(bamFile, ".bam") + ".bai", bamFile + ".csi"}
+	for _, idxFile := range candidates {
+		fh, err := os.Open(idxFile)
+		if err != nil {
+			continue
+		}
+		defer fh.Close()
+
+		if strings.HasSuffix(idxFile, ".csi") {
+			bgz, err := bgzf.NewReader(fh, 1)
+			if err != nil {
+				L.Fatalf("Could not open CSI index %s: %s\n", idxFile, err)
+			}
+			idx, err := csi.ReadFrom(bgz)
+			if err != nil {
+				L.Fatalf("Could not read CSI index %s: %s\n", idxFile, err)
+			}
+			return csiIndex{idx}
+		}
+
+		idx, err := bam.ReadIndex(bufio.NewReader(fh))
+		if err != nil {
+			L.Fatalf("Could not read BAM index %s: %s\n", idxFile, err)
+		}
+		return baiIndex{idx}
+	}
+
+	L.Fatalf("No .bai or .csi index found for %s!\n", bamFile)
+	return nil
+}
+
+// Struct to iterate over the records overlapping a set of regions:
+type RegionReader struct {
+	reader    *bam.Reader
+	index     bamIndex
+	refs      map[string]*sam.Reference
+	regions   []Region
+	iter      *bam.Iterator
+	curr      int    // Index of the current region.
+	prevChrom string // Chromosome of the previous region.
+	prevEnd   int    // End of the previous region.
+}
+
+// Create a new region reader from an indexed BAM file.
+func NewRegionReader(bamFile string, regions []Region, nrProc int) *RegionReader {
+	fh, err := os.Open(bamFile)
+	if err != nil {
+		L.Fatalf("Could not open input file %s: %s\n", bamFile, err)
+	}
+
+	// The BGZF reader needs a seekable source:
+	reader, err := bam.NewReader(fh, nrProc)
+	if err != nil {
+		L.Fatalf("Could not create BAM reader for %s: %s\n", bamFile, err)
+	}
+
+	refs := make(map[string]*sam.Reference)
+	for _, ref := range reader.Header().Refs() {
+		refs[ref.Name()] = ref
+	}
+
+	r := &RegionReader{
+		reader:  reader,
+		index:   LoadBamIndex(bamFile),
+		refs:    refs,
+		regions: resolveRegions(regions, refs),
+	}
+
+	return r
+}
+
+// Get the header of the underlying BAM file.
+func (r *RegionReader) Header() *sam.Header {
+	return r.reader.Header()
+}
+
+// Read the next record overlapping the regions.
+func (r *RegionReader) Read() (*sam.Record, error) {
+	for {
+		// Set up iterator for the next region:
+		if r.iter == nil {
+			if r.curr >= len(r.regions) {
+				return nil, io.EOF
+			}
+			reg := r.regions[r.curr]
+			chunks := r.index.Chunks(r.refs[reg.Chrom], reg.Start, reg.End)
+			if len(chunks) == 0 {
+				r.nextRegion()
+				continue
+			}
+			iter, err := bam.NewIterator(r.reader, chunks)
+			if err != nil {
+				return nil, err
+			}
+			r.iter = iter
+		}
+
+		// Region exhausted:
+		if !r.iter.Next() {
+			err := r.iter.Error()
+			r.iter.Close()
+			r.iter = nil
+			if err != nil {
+				return nil, err
+			}
+			r.nextRegion()
+			continue
+		}
+
+		record := r.iter.Record()
+		reg := r.regions[r.curr]
+
+		// Skip records not overlapping the region:
+		if record.Ref == nil || record.Ref.Name() != reg.Chrom || record.Pos >= reg.End || record.End() <= reg.Start {
+			continue
+		}
+		// Skip records already reported for the previous region:
+		if reg.Chrom == r.prevChrom && record.Pos < r.prevEnd {
+			continue
+		}
+
+		return record, nil
+	}
+}
+
+// Move on to the next region.
+func (r *RegionReader) nextRegion() {
+	r.prevChrom = r.regions[r.curr].Chrom
+	r.prevEnd = r.regions[r.curr].End
+	r.curr++
+}
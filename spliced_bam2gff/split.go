@@ -0,0 +1,141 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/biogo/biogo/feat/gene"
+	"github.com/biogo/biogo/io/featio/gff"
+	"github.com/biogo/hts/sam"
+)
+
+// Label of transcripts without sample:
+const untaggedSample = "untagged"
+
+// File extensions of the output formats:
+var formatExtensions = map[string]string{
+	FormatGFF2:  ".gff",
+	FormatGTF:   ".gtf",
+	FormatGFF3:  ".gff3",
+	FormatBED12: ".bed",
+}
+
+// Get the value of any SAM tag formatted as string.
+func auxValueString(record *sam.Record, tag string) (string, bool) {
+	aux, ok := record.Tag([]byte(tag))
+	if !ok {
+		return "", false
+	}
+	if aux.Type() == 'A' {
+		return string(aux.Value().(uint8)), true
+	}
+	return fmt.Sprint(aux.Value()), true
+}
+
+// Generate the sample attribute of a record from the value of the sample tag (if present).
+func SampleAttributes(record *sam.Record, sampleTag string) gff.Attributes {
+	sample, ok := auxValueString(record, sampleTag)
+	if !ok {
+		return nil
+	}
+	return gff.Attributes{gff.Attribute{Tag: "sample", Value: sample}}
+}
+
+// Maximum number of sample files kept open when splitting the output:
+const maxSampleFiles = 500
+
+// Struct to hold the output of a sample:
+type sampleOutput struct {
+	fh       *os.File
+	out      *bufio.Writer
+	trWriter TranscriptWriter
+}
+
+// Transcript writer writing the transcripts of each sample into a separate file:
+type SplitTranscriptWriter struct {
+	prefix   string
+	format   string
+	outputs  map[string]*sampleOutput
+	untagged *sampleOutput     // Output of transcripts without sample.
+	files    map[string]string // Samples by output file name.
+}
+
+// Create a new transcript writer splitting the transcripts by the sample
+// attribute into files named by the prefix, sample and format extension.
+func NewSplitTranscriptWriter(prefix string, format string) *SplitTranscriptWriter {
+	return &SplitTranscriptWriter{prefix: prefix, format: format, outputs: make(map[string]*sampleOutput), files: make(map[string]string)}
+}
+
+// Create the output file of a sample, failing if the file name is already
+// used by another sample or there are too many samples.
+func (w *SplitTranscriptWriter) newOutput(sample string) *sampleOutput {
+	if len(w.files) >= maxSampleFiles {
+		L.Fatalf("Too many samples for splitting the output (more than %d), use a sample tag with fewer distinct values!\n", maxSampleFiles)
+	}
+
+	// Make the sample safe to use in file names:
+	safeSample := strings.Map(func(r rune) rune {
+		if r == '/' || r == '\\' || r == ' ' {
+			return '_'
+		}
+		return r
+	}, sample)
+	outFile := w.prefix + safeSample + formatExtensions[w.format]
+	if other, ok := w.files[outFile]; ok {
+		L.Fatalf("Samples %s and %s would be written to the same output file %s!\n", other, sample, outFile)
+	}
+	w.files[outFile] = sample
+
+	fh, err := os.Create(outFile)
+	if err != nil {
+		L.Fatalf("Could not create output file %s: %s\n", outFile, err)
+	}
+	out := bufio.NewWriter(fh)
+	return &sampleOutput{fh, out, NewTranscriptWriter(out, w.format)}
+}
+
+// Write transcript into the file of its sample.
+func (w *SplitTranscriptWriter) Write(tr *gene.CodingTranscript, attrs gff.Attributes) {
+	sample, tagged := "", false
+	for _, attr := range attrs {
+		if attr.Tag == "sample" {
+			sample, tagged = attr.Value, true
+		}
+	}
+
+	if !tagged {
+		if w.untagged == nil {
+			w.untagged = w.newOutput(untaggedSample)
+		}
+		w.untagged.trWriter.Write(tr, attrs)
+		return
+	}
+
+	output, ok := w.outputs[sample]
+	if !ok {
+		output = w.newOutput(sample)
+		w.outputs[sample] = output
+	}
+	output.trWriter.Write(tr, attrs)
+}
+
+// Flush and close the output of a sample.
+func (output *sampleOutput) close(sample string) {
+	output.trWriter.Flush()
+	if err := output.out.Flush(); err != nil {
+		L.Fatalf("Failed to write output of sample %s: %s\n", sample, err)
+	}
+	output.fh.Close()
+}
+
+// Flush and close the files of all samples.
+func (w *SplitTranscriptWriter) Flush() {
+	for sample, output := range w.outputs {
+		output.close(sample)
+	}
+	if w.untagged != nil {
+		w.untagged.close(untaggedSample)
+	}
+}
@@ -0,0 +1,198 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/biogo/biogo/feat/gene"
+	"github.com/biogo/hts/sam"
+)
+
+// Sources of transcript orientation:
+const (
+	StrandSourceTag    = "tag"
+	StrandSourceRead   = "read"
+	StrandSourcePrimer = "primer"
+	StrandSourceMotif  = "motif"
+	StrandSourceNone   = "unoriented"
+)
+
+// Struct to hold conversion statistics:
+type ConvStats struct {
+	Records     int            // Number of input records.
+	Reads       int            // Number of primary records (one per read).
+	MappedReads int            // Number of mapped primary records.
+	Converted   int            // Number of transcripts written.
+	Strand      map[string]int // Transcripts by the source of their orientation.
+	ExonCounts  map[int]int    // Transcripts by number of exons.
+	IntronHist  map[int]int    // Introns by log2 length bin.
+	Chroms      map[string]int // Transcripts by chromosome.
+	chromsOrder []string       // Chromosomes in order of appearance.
+}
+
+// Create new conversion statistics.
+func NewConvStats() *ConvStats {
+	return &ConvStats{
+		Strand:     make(map[string]int),
+		ExonCounts: make(map[int]int),
+		IntronHist: make(map[int]int),
+		Chroms:     make(map[string]int),
+	}
+}
+
+// Register an input record. Reads are counted by their primary records, so
+// the secondary and supplementary alignments do not inflate the mapping rate.
+func (cs *ConvStats) AddRecord(record *sam.Record) {
+	cs.Records++
+	if record.Flags&(sam.Secondary|sam.Supplementary) != 0 {
+		return
+	}
+	cs.Reads++
+	if record.Flags&sam.Unmapped == 0 {
+		cs.MappedReads++
+	}
+}
+
+// Register a converted transcript and the source of its orientation.
+func (cs *ConvStats) Add(tr *gene.CodingTranscript, strandSrc string) {
+	cs.Converted++
+	cs.Strand[strandSrc]++
+
+	exons := tr.Exons()
+	cs.ExonCounts[len(exons)]++
+	for i := 0; i < len(exons)-1; i++ {
+		cs.IntronHist[log2Bin(exons[i+1].Start()-exons[i].End())]++
+	}
+
+	chrom := tr.Location().Name()
+	if _, ok := cs.Chroms[chrom]; !ok {
+		cs.chromsOrder = append(cs.chromsOrder, chrom)
+	}
+	cs.Chroms[chrom]++
+}
+
+// Get the log2 bin of a length: bin k holds lengths in [2^k, 2^(k+1)).
+func log2Bin(length int) int {
+	var bin int
+	for length > 1 {
+		length >>= 1
+		bin++
+	}
+	return bin
+}
+
+// Struct to hold a row of a count table in the report:
+type reportCount struct {
+	Key   string `json:"key"`
+	Count int    `json:"count"`
+}
+
+// Struct to hold the conversion summary report:
+type convReport struct {
+	Records      int            `json:"records"`
+	Reads        int            `json:"reads"`
+	Mapped       int            `json:"mapped_reads"`
+	Converted    int            `json:"converted"`
+	Discarded    map[string]int `json:"discarded"`
+	Malformed    map[string]int `json:"malformed"`
+	Strand       map[string]int `json:"strand"`
+	ExonCounts   []reportCount  `json:"exon_counts"`
+	IntronLength []reportCount  `json:"intron_length"`
+	Chromosomes  []reportCount  `json:"chromosomes"`
+}
+
+// Build the report from the statistics and the discarded and malformed record counts.
+func (cs *ConvStats) report(discarded DiscardCounts, malformed map[string]int) convReport {
+	rep := convReport{
+		Records:   cs.Records,
+		Reads:     cs.Reads,
+		Mapped:    cs.MappedReads,
+		Converted: cs.Converted,
+		Discarded: discarded,
+		Malformed: malformed,
+		Strand:    cs.Strand,
+	}
+
+	exonCounts := make([]int, 0, len(cs.ExonCounts))
+	for nrExons := range cs.ExonCounts {
+		exonCounts = append(exonCounts, nrExons)
+	}
+	sort.Ints(exonCounts)
+	for _, nrExons := range exonCounts {
+		rep.ExonCounts = append(rep.ExonCounts, reportCount{fmt.Sprintf("%d", nrExons), cs.ExonCounts[nrExons]})
+	}
+
+	bins := make([]int, 0, len(cs.IntronHist))
+	for bin := range cs.IntronHist {
+		bins = append(bins, bin)
+	}
+	sort.Ints(bins)
+	for _, bin := range bins {
+		rep.IntronLength = append(rep.IntronLength, reportCount{fmt.Sprintf("%d-%d", 1<<uint(bin), (1<<uint(bin+1))-1), cs.IntronHist[bin]})
+	}
+
+	for _, chrom := range cs.chromsOrder {
+		rep.Chromosomes = append(rep.Chromosomes, reportCount{chrom, cs.Chroms[chrom]})
+	}
+
+	return rep
+}
+
+// Write the conversion summary report in JSON format if the file name ends
+// in .json, otherwise in TSV format (section, key and count columns).
+func (cs *ConvStats) Write(reportFile string, discarded DiscardCounts, malformed map[string]int) {
+	fh, err := os.Create(reportFile)
+	if err != nil {
+		L.Fatalf("Could not create summary report %s: %s\n", reportFile, err)
+	}
+	out := bufio.NewWriter(fh)
+	rep := cs.report(discarded, malformed)
+
+	if strings.HasSuffix(strings.ToLower(reportFile), ".json") {
+		enc := json.NewEncoder(out)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(rep); err != nil {
+			L.Fatalf("Failed to encode summary report: %s\n", err)
+		}
+	} else {
+		fmt.Fprintf(out, "Section\tKey\tCount\n")
+		fmt.Fprintf(out, "records\ttotal\t%d\n", rep.Records)
+		fmt.Fprintf(out, "reads\ttotal\t%d\n", rep.Reads)
+		fmt.Fprintf(out, "reads\tmapped\t%d\n", rep.Mapped)
+		fmt.Fprintf(out, "records\tconverted\t%d\n", rep.Converted)
+		writeTSVMap(out, "discarded", rep.Discarded)
+		writeTSVMap(out, "malformed", rep.Malformed)
+		writeTSVMap(out, "strand", rep.Strand)
+		writeTSVCounts(out, "exon_count", rep.ExonCounts)
+		writeTSVCounts(out, "intron_length", rep.IntronLength)
+		writeTSVCounts(out, "chromosome", rep.Chromosomes)
+	}
+
+	if err := out.Flush(); err != nil {
+		L.Fatalf("Failed to write summary report %s: %s\n", reportFile, err)
+	}
+	fh.Close()
+}
+
+// Write a map of counts as TSV rows, sorted by key.
+func writeTSVMap(out *bufio.Writer, section string, counts map[string]int) {
+	keys := make([]string, 0, len(counts))
+	for key := range counts {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		fmt.Fprintf(out, "%s\t%s\t%d\n", section, key, counts[key])
+	}
+}
+
+// Write a slice of counts as TSV rows.
+func writeTSVCounts(out *bufio.Writer, section string, counts []reportCount) {
+	for _, c := range counts {
+		fmt.Fprintf(out, "%s\t%s\t%d\n", section, c.Key, c.Count)
+	}
+}
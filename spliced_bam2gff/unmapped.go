@@ -0,0 +1,75 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/biogo/hts/sam"
+)
+
+// Struct to write the reads of unmapped, filtered, duplicate and malformed records to a side file:
+type UnmappedWriter struct {
+	fh    *os.File
+	out   *bufio.Writer
+	fastq bool // Write sequences in FASTQ format instead of read names.
+}
+
+// Create writer for unmapped and filtered reads. Reads are written in FASTQ format
+// if the file name ends in .fq or .fastq, otherwise their names and the reasons
+// for discarding them are written in TSV format.
+func NewUnmappedWriter(unmappedFile string) *UnmappedWriter {
+	fh, err := os.Create(unmappedFile)
+	if err != nil {
+		L.Fatalf("Could not create unmapped reads file %s: %s\n", unmappedFile, err)
+	}
+	lower := strings.ToLower(unmappedFile)
+	w := &UnmappedWriter{
+		fh:    fh,
+		out:   bufio.NewWriter(fh),
+		fastq: strings.HasSuffix(lower, ".fq") || strings.HasSuffix(lower, ".fastq"),
+	}
+	if !w.fastq {
+		fmt.Fprintf(w.out, "Read\tReason\n")
+	}
+	return w
+}
+
+// Write the read of a discarded record. Only primary records are written, so each read is reported once.
+func (w *UnmappedWriter) Write(record *sam.Record, reason string) {
+	if record.Flags&(sam.Secondary|sam.Supplementary) != 0 {
+		return
+	}
+	if !w.fastq {
+		fmt.Fprintf(w.out, "%s\t%s\n", record.Name, reason)
+		return
+	}
+
+	seq := string(record.Seq.Expand())
+	qual := make([]byte, len(seq))
+	for i := range qual {
+		// Missing qualities are set to zero:
+		if i < len(record.Qual) && record.Qual[i] != 0xff {
+			qual[i] = record.Qual[i] + 33
+		} else {
+			qual[i] = '!'
+		}
+	}
+
+	// Restore the original orientation of reverse strand reads:
+	if record.Flags&sam.Reverse != 0 {
+		seq = revComp(seq)
+		qual = []byte(reverseString(string(qual)))
+	}
+
+	fmt.Fprintf(w.out, "@%s reason=%s\n%s\n+\n%s\n", record.Name, reason, seq, qual)
+}
+
+// Flush and close the unmapped reads file.
+func (w *UnmappedWriter) Close() {
+	if err := w.out.Flush(); err != nil {
+		L.Fatalf("Failed to write unmapped reads file: %s\n", err)
+	}
+	w.fh.Close()
+}
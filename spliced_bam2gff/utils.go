@@ -0,0 +1,58 @@
+package main
+
+import (
+	"github.com/biogo/hts/sam"
+)
+
+// Calculate absolute value of integer.
+func Abs(i int) int {
+	if i < 0 {
+		return -i
+	}
+	return i
+}
+
+// Return the larger of two integers.
+func MaxInt(a, b int) int {
+	if a > b {
+		return a
+	}
+	return b
+}
+
+// Return the smaller of two integers.
+func MinInt(a, b int) int {
+	if a < b {
+		return a
+	}
+	return b
+}
+
+// Get the value of an integer SAM tag.
+func auxInt(aux sam.Aux) (int, bool) {
+	switch v := aux.Value().(type) {
+	case int8:
+		return int(v), true
+	case uint8:
+		return int(v), true
+	case int16:
+		return int(v), true
+	case uint16:
+		return int(v), true
+	case int32:
+		return int(v), true
+	case uint32:
+		return int(v), true
+	}
+	return 0, false
+}
+
+// Get the value of a string SAM tag.
+func auxString(record *sam.Record, tag string) (string, bool) {
+	aux, ok := record.Tag([]byte(tag))
+	if !ok {
+		return "", false
+	}
+	v, ok := aux.Value().(string)
+	return v, ok
+}